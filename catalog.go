@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"mirakurun-exporter/collector"
+)
+
+type catalogEntry struct {
+	Collector string `json:"collector"`
+	collector.MetricInfo
+}
+
+var catalogTemplate = template.Must(template.New("catalog").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<title>Mirakurun Exporter Metrics</title>
+	<style>
+		table { border-collapse: collapse; }
+		th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+		code { white-space: nowrap; }
+	</style>
+</head>
+<body>
+	<h1>Metrics</h1>
+	<p><a href="/metrics/catalog?format=json">JSON</a></p>
+	<table>
+		<tr><th>Collector</th><th>Name</th><th>Type</th><th>Help</th><th>Labels</th><th>Source</th></tr>
+		{{- range . }}
+		<tr>
+			<td>{{ .Collector }}</td>
+			<td><code>{{ .Name }}</code></td>
+			<td>{{ .Type }}</td>
+			<td>{{ .Help }}{{ if .Note }}<br>{{ .Note }}{{ end }}</td>
+			<td>{{ range $i, $l := .Labels }}{{ if $i }}, {{ end }}<code>{{ $l }}</code>{{ end }}</td>
+			<td>{{ .Source }}</td>
+		</tr>
+		{{- end }}
+	</table>
+</body>
+</html>
+`))
+
+// catalogHandler serves the list of the metrics the collectors can emit as
+// HTML, or as JSON with ?format=json or an Accept header asking for it.
+func catalogHandler(collectors []namedCollector) http.Handler {
+	var entries []catalogEntry
+	for _, c := range collectors {
+		for _, m := range collector.Describe(c) {
+			entries = append(entries, catalogEntry{Collector: c.name, MetricInfo: m})
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.Encode(entries)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		catalogTemplate.Execute(w, entries)
+	})
+}
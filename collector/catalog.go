@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"reflect"
+	"strings"
+)
+
+// metricSources tells where the metrics come from by the longest matching
+// name prefix.
+var metricSources = map[string]string{
+	"mirakurun_up":                            "/api/status",
+	"mirakurun_status_epg_gatheringnetworks":  "/api/status epg.storedEvents",
+	"mirakurun_process_":                      "/api/status process",
+	"mirakurun_host_memory_":                  "MIRAKURUN_HOST_MEMINFO",
+	"mirakurun_process_rss_host_memory_ratio": "/api/status process.memoryUsage.rss, MIRAKURUN_HOST_MEMINFO",
+	"mirakurun_process_restarts_total":        "/api/status process.pid, errorCount",
+	"mirakurun_events_stream_":                "/api/events/stream",
+	"mirakurun_clock_":                        "/api/status time",
+	"mirakurun_verison_current_version":       "/api/version current",
+	"mirakurun_version_latest_version":        "/api/version latest",
+	"mirakurun_server_info":                   "Server header of /api/version",
+	"mirakurun_tuner_":                        "/api/tuners",
+	"mirakurun_tuner_signal_":                 "MIRAKURUN_SIGNAL_CONFIG",
+	"mirakurun_probe_":                        "/api/channels/{type}/{channel}/stream",
+	"mirakurun_config_server_":                "/api/config/server",
+	"mirakurun_config_":                       "/api/config/server, /api/config/tuners, /api/config/channels",
+	"mirakurun_forecast_":                     "/api/tuners, /api/services, /api/programs",
+	"mirakurun_epgstation_":                   "EPGStation /api/reserves/cnts, /api/recording, /api/recorded, /api/encode, /api/storages",
+	"mirakurun_chinachu_":                     "Chinachu /api/reserves.json, /api/recording.json, /api/recorded.json, /api/storage.json, /api/status.json",
+	"mirakurun_timeshift_":                    "/api/timeshift",
+	"mirakurun_service_onair_":                "/api/onair, /api/programs",
+	"mirakurun_programs":                      "/api/programs",
+	"mirakurun_exporter_upstream_":            "Requests of the exporter to every API above",
+	"mirakurun_epg_":                          "/api/programs",
+}
+
+// metricNotes explains the metrics whose name and help are not enough.
+var metricNotes = map[string]string{
+	"mirakurun_status_process_env_usingwinser": "1 when Mirakurun runs as a Windows service through winser.",
+	"mirakurun_status_epg_gatheringnetworks": "Despite the name, the number of stored EPG events, the same as mirakurun_status_epg_storedevents. " +
+		"It is kept as is for existing dashboards.",
+	"mirakurun_status_streamcount_tunerdevice": "Number of streams read from tuner devices.",
+	"mirakurun_status_streamcount_tsfilter":    "Number of TS filters, one per stream served to a client.",
+	"mirakurun_status_streamcount_decoder":     "Number of running decoder processes.",
+	"mirakurun_status_errorcount_bufferoverflow": "Number of times a stream buffer overflowed since Mirakurun started. " +
+		"It usually means a client reads too slowly.",
+	"mirakurun_verison_current_version": "Always 1. The running version is in the version label.",
+	"mirakurun_version_latest_version":  "Always 1. The latest version on npm is in the version label.",
+}
+
+// statusFields maps the name of a mirakurun_status_* metric to the field
+// of /api/status it is read from.
+var statusFields = func() map[string]string {
+	fields := make(map[string]string)
+	var walk func(t reflect.Type, name, path string)
+	walk = func(t reflect.Type, name, path string) {
+		if t.Kind() != reflect.Struct {
+			fields[name] = path
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			tag := t.Field(i).Tag.Get("json")
+			walk(t.Field(i).Type,
+				name+"_"+strings.ToLower(strings.Replace(tag, "_", "", -1)),
+				strings.TrimPrefix(path+"."+tag, "."))
+		}
+	}
+	walk(reflect.TypeOf(Status{}), "mirakurun_status", "")
+	return fields
+}()
+
+func metricSource(name string) string {
+	// 名前どおりのフィールドから読んでいないものは metricSources が優先
+	if source, ok := metricSources[name]; ok {
+		return source
+	}
+	if field, ok := statusFields[name]; ok {
+		return "/api/status " + field
+	}
+	source, longest := "", 0
+	for prefix, s := range metricSources {
+		if strings.HasPrefix(name, prefix) && len(prefix) > longest {
+			source, longest = s, len(prefix)
+		}
+	}
+	return source
+}
@@ -0,0 +1,196 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// JSON展開用
+type ChinachuReserve struct {
+	IsConflict bool `json:"isConflict"`
+	IsSkip     bool `json:"isSkip"`
+}
+
+// JSON展開用
+type ChinachuStorage struct {
+	Size     float64 `json:"size"`
+	Used     float64 `json:"used"`
+	Avail    float64 `json:"avail"`
+	Recorded float64 `json:"recorded"`
+}
+
+// JSON展開用
+type ChinachuStatus struct {
+	ConnectedCount int `json:"connectedCount"`
+	Operator       struct {
+		Alive bool `json:"alive"`
+	} `json:"operator"`
+	Wui struct {
+		Alive bool `json:"alive"`
+	} `json:"wui"`
+}
+
+type chinachuCollector struct {
+	up               *prometheus.Desc
+	reserves         *prometheus.Desc
+	recording        *prometheus.Desc
+	recorded         *prometheus.Desc
+	storageSize      *prometheus.Desc
+	storageUsed      *prometheus.Desc
+	storageAvailable *prometheus.Desc
+	storageRecorded  *prometheus.Desc
+	operatorAlive    *prometheus.Desc
+	wuiAlive         *prometheus.Desc
+	connected        *prometheus.Desc
+}
+
+func NewChinachuCollector() *chinachuCollector {
+	return &chinachuCollector{
+		up: newDesc(
+			"mirakurun_chinachu_up",
+			"Whether every Chinachu API request succeeded.",
+			[]string{"host"},
+			nil),
+		reserves: newDesc(
+			"mirakurun_chinachu_reserves",
+			"Number of Chinachu reserves by state.",
+			[]string{"host", "state"},
+			nil),
+		recording: newDesc(
+			"mirakurun_chinachu_recording",
+			"Number of programs Chinachu is recording.",
+			[]string{"host"},
+			nil),
+		recorded: newDesc(
+			"mirakurun_chinachu_recorded",
+			"Number of recorded programs in Chinachu.",
+			[]string{"host"},
+			nil),
+		storageSize: newDesc(
+			"mirakurun_chinachu_storage_size_bytes",
+			"Size of the Chinachu recording storage.",
+			[]string{"host"},
+			nil),
+		storageUsed: newDesc(
+			"mirakurun_chinachu_storage_used_bytes",
+			"Used space of the Chinachu recording storage.",
+			[]string{"host"},
+			nil),
+		storageAvailable: newDesc(
+			"mirakurun_chinachu_storage_available_bytes",
+			"Free space of the Chinachu recording storage.",
+			[]string{"host"},
+			nil),
+		storageRecorded: newDesc(
+			"mirakurun_chinachu_storage_recorded_bytes",
+			"Space used by recorded programs in Chinachu.",
+			[]string{"host"},
+			nil),
+		operatorAlive: newDesc(
+			"mirakurun_chinachu_operator_alive",
+			"Whether the Chinachu operator is alive.",
+			[]string{"host"},
+			nil),
+		wuiAlive: newDesc(
+			"mirakurun_chinachu_wui_alive",
+			"Whether the Chinachu WUI is alive.",
+			[]string{"host"},
+			nil),
+		connected: newDesc(
+			"mirakurun_chinachu_connected_clients",
+			"Number of clients connected to the Chinachu WUI.",
+			[]string{"host"},
+			nil),
+	}
+}
+
+// Enabled reports whether the collector is configured to collect anything.
+func (cc *chinachuCollector) Enabled() bool {
+	return configured("CHINACHU")
+}
+
+func (cc *chinachuCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.up
+	ch <- cc.reserves
+	ch <- cc.recording
+	ch <- cc.recorded
+	ch <- cc.storageSize
+	ch <- cc.storageUsed
+	ch <- cc.storageAvailable
+	ch <- cc.storageRecorded
+	ch <- cc.operatorAlive
+	ch <- cc.wuiAlive
+	ch <- cc.connected
+}
+
+func (cc *chinachuCollector) Collect(ch chan<- prometheus.Metric) {
+	if !cc.Enabled() {
+		return
+	}
+
+	ctx := context.Background()
+	// ラベルはMirakurunのホストに揃える
+	host := newAPI().Host
+	api := lookupAPI("CHINACHU", "20772")
+	up := 1.0
+	failed := func(err error) {
+		logError("chinachu", err)
+		up = 0
+	}
+
+	var reserves []ChinachuReserve
+	if err := fetchJSON(ctx, &api, "reserves.json", &Query{}, &reserves); err != nil {
+		failed(err)
+	} else {
+		var normal, conflict, skip float64
+		for _, r := range reserves {
+			switch {
+			case r.IsSkip:
+				skip++
+			case r.IsConflict:
+				conflict++
+			default:
+				normal++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(cc.reserves, prometheus.GaugeValue, normal, host, "normal")
+		ch <- prometheus.MustNewConstMetric(cc.reserves, prometheus.GaugeValue, conflict, host, "conflict")
+		ch <- prometheus.MustNewConstMetric(cc.reserves, prometheus.GaugeValue, skip, host, "skip")
+	}
+
+	var recording []struct{}
+	if err := fetchJSON(ctx, &api, "recording.json", &Query{}, &recording); err != nil {
+		failed(err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(cc.recording, prometheus.GaugeValue, float64(len(recording)), host)
+	}
+
+	var recorded []struct{}
+	if err := fetchJSON(ctx, &api, "recorded.json", &Query{}, &recorded); err != nil {
+		failed(err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(cc.recorded, prometheus.GaugeValue, float64(len(recorded)), host)
+	}
+
+	var storage ChinachuStorage
+	if err := fetchJSON(ctx, &api, "storage.json", &Query{}, &storage); err != nil {
+		failed(err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(cc.storageSize, prometheus.GaugeValue, storage.Size, host)
+		ch <- prometheus.MustNewConstMetric(cc.storageUsed, prometheus.GaugeValue, storage.Used, host)
+		ch <- prometheus.MustNewConstMetric(cc.storageAvailable, prometheus.GaugeValue, storage.Avail, host)
+		ch <- prometheus.MustNewConstMetric(cc.storageRecorded, prometheus.GaugeValue, storage.Recorded, host)
+	}
+
+	var status ChinachuStatus
+	if err := fetchJSON(ctx, &api, "status.json", &Query{}, &status); err != nil {
+		failed(err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(cc.operatorAlive, prometheus.GaugeValue, boolToFloat(status.Operator.Alive), host)
+		ch <- prometheus.MustNewConstMetric(cc.wuiAlive, prometheus.GaugeValue, boolToFloat(status.Wui.Alive), host)
+		ch <- prometheus.MustNewConstMetric(cc.connected, prometheus.GaugeValue, float64(status.ConnectedCount), host)
+	}
+
+	ch <- prometheus.MustNewConstMetric(cc.up, prometheus.GaugeValue, up, host)
+}
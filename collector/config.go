@@ -0,0 +1,293 @@
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// JSON展開用
+type ServerConfig struct {
+	Path                      *string  `json:"path"`
+	Port                      *int     `json:"port"`
+	Hostname                  string   `json:"hostname"`
+	LogLevel                  *float64 `json:"logLevel"`
+	MaxBufferBytesBeforeReady *float64 `json:"maxBufferBytesBeforeReady"`
+	ProgramGCInterval         *float64 `json:"programGCInterval"`
+	EpgGatheringInterval      *float64 `json:"epgGatheringInterval"`
+	EpgRetrievalTime          *float64 `json:"epgRetrievalTime"`
+}
+
+type serverConfigCollector struct {
+	info                      *prometheus.Desc
+	httpEnabled               *prometheus.Desc
+	unixEnabled               *prometheus.Desc
+	logLevel                  *prometheus.Desc
+	maxBufferBytesBeforeReady *prometheus.Desc
+	programGCInterval         *prometheus.Desc
+	epgGatheringInterval      *prometheus.Desc
+	epgRetrievalTime          *prometheus.Desc
+}
+
+func NewServerConfigCollector() *serverConfigCollector {
+	return &serverConfigCollector{
+		info: newDesc(
+			"mirakurun_config_server_info",
+			"Listen path, port and hostname from /api/config/server.",
+			[]string{"host", "path", "port", "hostname"},
+			nil),
+		httpEnabled: newDesc(
+			"mirakurun_config_server_http_enabled",
+			"Whether mirakurun listens on a TCP port.",
+			[]string{"host"},
+			nil),
+		unixEnabled: newDesc(
+			"mirakurun_config_server_unix_enabled",
+			"Whether mirakurun listens on a Unix socket.",
+			[]string{"host"},
+			nil),
+		logLevel: newDesc(
+			"mirakurun_config_server_log_level",
+			"Configured log level of mirakurun.",
+			[]string{"host"},
+			nil),
+		maxBufferBytesBeforeReady: newDesc(
+			"mirakurun_config_server_max_buffer_bytes_before_ready",
+			"Configured maxBufferBytesBeforeReady of mirakurun.",
+			[]string{"host"},
+			nil),
+		programGCInterval: newDesc(
+			"mirakurun_config_server_program_gc_interval_seconds",
+			"Configured programGCInterval of mirakurun.",
+			[]string{"host"},
+			nil),
+		epgGatheringInterval: newDesc(
+			"mirakurun_config_server_epg_gathering_interval_seconds",
+			"Configured epgGatheringInterval of mirakurun.",
+			[]string{"host"},
+			nil),
+		epgRetrievalTime: newDesc(
+			"mirakurun_config_server_epg_retrieval_time_seconds",
+			"Configured epgRetrievalTime of mirakurun.",
+			[]string{"host"},
+			nil),
+	}
+}
+
+func (cc *serverConfigCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.info
+	ch <- cc.httpEnabled
+	ch <- cc.unixEnabled
+	ch <- cc.logLevel
+	ch <- cc.maxBufferBytesBeforeReady
+	ch <- cc.programGCInterval
+	ch <- cc.epgGatheringInterval
+	ch <- cc.epgRetrievalTime
+}
+
+func (cc *serverConfigCollector) Collect(ch chan<- prometheus.Metric) {
+	api := newAPI()
+	var config ServerConfig
+	if err := fetchJSON(context.Background(), &api, "config/server", &Query{}, &config); err != nil {
+		logError("config/server", err)
+		return
+	}
+
+	var path, port string
+	var httpEnabled, unixEnabled float64
+	if config.Path != nil && *config.Path != "" {
+		path = *config.Path
+		unixEnabled = 1
+	}
+	if config.Port != nil {
+		port = strconv.Itoa(*config.Port)
+		httpEnabled = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(cc.info, prometheus.GaugeValue, 1, api.Host, path, port, config.Hostname)
+	ch <- prometheus.MustNewConstMetric(cc.httpEnabled, prometheus.GaugeValue, httpEnabled, api.Host)
+	ch <- prometheus.MustNewConstMetric(cc.unixEnabled, prometheus.GaugeValue, unixEnabled, api.Host)
+
+	// 未設定の項目はMirakurunのデフォルトが使われるので出力しない
+	if config.LogLevel != nil {
+		ch <- prometheus.MustNewConstMetric(cc.logLevel, prometheus.GaugeValue, *config.LogLevel, api.Host)
+	}
+	if config.MaxBufferBytesBeforeReady != nil {
+		ch <- prometheus.MustNewConstMetric(cc.maxBufferBytesBeforeReady, prometheus.GaugeValue, *config.MaxBufferBytesBeforeReady, api.Host)
+	}
+	if config.ProgramGCInterval != nil {
+		ch <- prometheus.MustNewConstMetric(cc.programGCInterval, prometheus.GaugeValue, *config.ProgramGCInterval/1000, api.Host)
+	}
+	if config.EpgGatheringInterval != nil {
+		ch <- prometheus.MustNewConstMetric(cc.epgGatheringInterval, prometheus.GaugeValue, *config.EpgGatheringInterval/1000, api.Host)
+	}
+	if config.EpgRetrievalTime != nil {
+		ch <- prometheus.MustNewConstMetric(cc.epgRetrievalTime, prometheus.GaugeValue, *config.EpgRetrievalTime/1000, api.Host)
+	}
+}
+
+// JSON展開用
+type TunerConfig struct {
+	Name                string   `json:"name"`
+	Types               []string `json:"types"`
+	Command             string   `json:"command"`
+	DvbDevicePath       string   `json:"dvbDevicePath"`
+	RemoteMirakurunHost string   `json:"remoteMirakurunHost"`
+	IsDisabled          bool     `json:"isDisabled"`
+}
+
+// JSON展開用
+type ChannelConfig struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Channel    string `json:"channel"`
+	ServiceID  int    `json:"serviceId"`
+	IsDisabled bool   `json:"isDisabled"`
+}
+
+// configHash hashes body after normalizing it, so that key order and
+// whitespace in the response do not change the hash.
+func configHash(body []byte) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", err
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(normalized)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type configDriftCollector struct {
+	hash          *prometheus.Desc
+	lastChange    *prometheus.Desc
+	tunersCount   *prometheus.Desc
+	channelsCount *prometheus.Desc
+
+	mu      sync.Mutex
+	hashes  map[string]string
+	changed map[string]time.Time
+	target  targetRoot
+}
+
+func NewConfigDriftCollector() *configDriftCollector {
+	return &configDriftCollector{
+		hash: newDesc(
+			"mirakurun_config_hash_info",
+			"SHA-256 of the normalized /api/config/{config} response.",
+			[]string{"host", "config", "hash"},
+			nil),
+		lastChange: newDesc(
+			"mirakurun_config_last_change_timestamp_seconds",
+			"Time the exporter saw the config hash change, or first saw the config.",
+			[]string{"host", "config"},
+			nil),
+		tunersCount: newDesc(
+			"mirakurun_config_tuners",
+			"Number of tuners in the tuners config.",
+			[]string{"host", "state"},
+			nil),
+		channelsCount: newDesc(
+			"mirakurun_config_channels",
+			"Number of channels in the channels config.",
+			[]string{"host", "state"},
+			nil),
+		hashes:  make(map[string]string),
+		changed: make(map[string]time.Time),
+	}
+}
+
+func (cc *configDriftCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.hash
+	ch <- cc.lastChange
+	ch <- cc.tunersCount
+	ch <- cc.channelsCount
+}
+
+func (cc *configDriftCollector) Collect(ch chan<- prometheus.Metric) {
+	api := newAPI()
+
+	// 別の Mirakurun の設定と比べて変更とみなさない
+	cc.mu.Lock()
+	if cc.target.changed(&api) {
+		cc.hashes = make(map[string]string)
+		cc.changed = make(map[string]time.Time)
+	}
+	cc.mu.Unlock()
+
+	if body := cc.collectHash(ch, &api, "tuners"); body != nil {
+		var tuners []TunerConfig
+		if err := json.Unmarshal(body, &tuners); err != nil {
+			logError("config", fmt.Errorf("tuners: %w", err))
+		} else {
+			var enabled, disabled float64
+			for _, t := range tuners {
+				if t.IsDisabled {
+					disabled++
+				} else {
+					enabled++
+				}
+			}
+			ch <- prometheus.MustNewConstMetric(cc.tunersCount, prometheus.GaugeValue, enabled, api.Host, "enabled")
+			ch <- prometheus.MustNewConstMetric(cc.tunersCount, prometheus.GaugeValue, disabled, api.Host, "disabled")
+		}
+	}
+
+	if body := cc.collectHash(ch, &api, "channels"); body != nil {
+		var channels []ChannelConfig
+		if err := json.Unmarshal(body, &channels); err != nil {
+			logError("config", fmt.Errorf("channels: %w", err))
+		} else {
+			var enabled, disabled float64
+			for _, c := range channels {
+				if c.IsDisabled {
+					disabled++
+				} else {
+					enabled++
+				}
+			}
+			ch <- prometheus.MustNewConstMetric(cc.channelsCount, prometheus.GaugeValue, enabled, api.Host, "enabled")
+			ch <- prometheus.MustNewConstMetric(cc.channelsCount, prometheus.GaugeValue, disabled, api.Host, "disabled")
+		}
+	}
+}
+
+// collectHash fetches /api/config/{config}, exports its hash and returns the
+// body, or nil if it could not be fetched.
+func (cc *configDriftCollector) collectHash(ch chan<- prometheus.Metric, api *ApiInfo, config string) []byte {
+	body, err := fetchBody(context.Background(), api, "config/"+config, &Query{})
+	if err != nil {
+		logError("config", fmt.Errorf("%s: %w", config, err))
+		return nil
+	}
+	hash, err := configHash(body)
+	if err != nil {
+		logError("config", fmt.Errorf("%s: %w", config, err))
+		return nil
+	}
+
+	cc.mu.Lock()
+	if cc.hashes[config] != hash {
+		if _, ok := cc.hashes[config]; ok {
+			slog.Info("config changed", "config", config)
+		}
+		cc.hashes[config] = hash
+		cc.changed[config] = time.Now()
+	}
+	changed := cc.changed[config]
+	cc.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(cc.hash, prometheus.GaugeValue, 1, api.Host, config, hash)
+	ch <- prometheus.MustNewConstMetric(cc.lastChange, prometheus.GaugeValue, float64(changed.Unix()), api.Host, config)
+	return body
+}
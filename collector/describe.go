@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metric types as in the exposition format.
+const (
+	MetricGauge     = "gauge"
+	MetricCounter   = "counter"
+	MetricHistogram = "histogram"
+)
+
+// MetricInfo describes a metric a collector can emit.
+type MetricInfo struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Help   string   `json:"help"`
+	Labels []string `json:"labels"`
+	Source string   `json:"source,omitempty"`
+	Note   string   `json:"note,omitempty"`
+}
+
+// histograms and counters list the metrics emitted as such. The others are
+// gauges.
+var (
+	histograms = map[string]bool{
+		"mirakurun_programs_duration_seconds": true,
+		"mirakurun_programs_advance_seconds":  true,
+
+		"mirakurun_exporter_upstream_request_duration_seconds": true,
+		"mirakurun_exporter_upstream_response_size_bytes":      true,
+	}
+	counters = map[string]bool{
+		"mirakurun_status_time":                     true,
+		"mirakurun_process_restarts_total":          true,
+		"mirakurun_events_stream_disconnects_total": true,
+		"mirakurun_epg_rescheduled_programs_total":  true,
+		"mirakurun_epg_removed_programs_total":      true,
+		"mirakurun_epg_extended_programs_total":     true,
+	}
+)
+
+// prometheus.Desc は名前などを公開していないので作るときに控えておく
+var descs = struct {
+	sync.Mutex
+	m map[*prometheus.Desc]MetricInfo
+}{m: make(map[*prometheus.Desc]MetricInfo)}
+
+func recordDesc(desc *prometheus.Desc, name, help string, labels []string) {
+	m := MetricInfo{
+		Name:   name,
+		Type:   metricType(name),
+		Help:   help,
+		Labels: append([]string{}, labels...),
+		Source: metricSource(name),
+		Note:   metricNotes[name],
+	}
+	descs.Lock()
+	descs.m[desc] = m
+	descs.Unlock()
+}
+
+// newDesc is prometheus.NewDesc that keeps the metadata for Describe.
+func newDesc(name, help string, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	desc := prometheus.NewDesc(name, help, variableLabels, constLabels)
+	recordDesc(desc, name, help, variableLabels)
+	return desc
+}
+
+// newHistogramVec is prometheus.NewHistogramVec that keeps the metadata for
+// Describe.
+func newHistogramVec(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	v := prometheus.NewHistogramVec(opts, labels)
+	ch := make(chan *prometheus.Desc, 1)
+	v.Describe(ch)
+	recordDesc(<-ch, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, labels)
+	return v
+}
+
+// Describe returns the metrics c describes. It does not contact Mirakurun.
+func Describe(c prometheus.Collector) []MetricInfo {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+
+	var metrics []MetricInfo
+	for desc := range ch {
+		descs.Lock()
+		m, ok := descs.m[desc]
+		descs.Unlock()
+		if ok {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+func metricType(name string) string {
+	switch {
+	case histograms[name]:
+		return MetricHistogram
+	case counters[name]:
+		return MetricCounter
+	default:
+		return MetricGauge
+	}
+}
@@ -0,0 +1,178 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// JSON展開用
+type EPGStationReserveCounts struct {
+	Normal    int `json:"normal"`
+	Conflicts int `json:"conflicts"`
+	Skips     int `json:"skips"`
+	Overlaps  int `json:"overlaps"`
+}
+
+// JSON展開用
+type EPGStationRecords struct {
+	Total int `json:"total"`
+}
+
+// JSON展開用
+type EPGStationStorages struct {
+	Items []struct {
+		Name      string  `json:"name"`
+		Available float64 `json:"available"`
+		Used      float64 `json:"used"`
+		Total     float64 `json:"total"`
+	} `json:"items"`
+}
+
+// JSON展開用
+type EPGStationEncode struct {
+	RunningItems []struct{} `json:"runningItems"`
+	WaitItems    []struct{} `json:"waitItems"`
+}
+
+type epgstationCollector struct {
+	up               *prometheus.Desc
+	reserves         *prometheus.Desc
+	recording        *prometheus.Desc
+	recorded         *prometheus.Desc
+	encodeRunning    *prometheus.Desc
+	encodeWaiting    *prometheus.Desc
+	storageAvailable *prometheus.Desc
+	storageUsed      *prometheus.Desc
+	storageTotal     *prometheus.Desc
+}
+
+func NewEPGStationCollector() *epgstationCollector {
+	return &epgstationCollector{
+		up: newDesc(
+			"mirakurun_epgstation_up",
+			"Whether every EPGStation API request succeeded.",
+			[]string{"host"},
+			nil),
+		reserves: newDesc(
+			"mirakurun_epgstation_reserves",
+			"Number of EPGStation reserves by state.",
+			[]string{"host", "state"},
+			nil),
+		recording: newDesc(
+			"mirakurun_epgstation_recording",
+			"Number of programs EPGStation is recording.",
+			[]string{"host"},
+			nil),
+		recorded: newDesc(
+			"mirakurun_epgstation_recorded",
+			"Number of recorded programs in EPGStation.",
+			[]string{"host"},
+			nil),
+		encodeRunning: newDesc(
+			"mirakurun_epgstation_encode_running",
+			"Number of running EPGStation encodes.",
+			[]string{"host"},
+			nil),
+		encodeWaiting: newDesc(
+			"mirakurun_epgstation_encode_waiting",
+			"Number of EPGStation encodes waiting in the queue.",
+			[]string{"host"},
+			nil),
+		storageAvailable: newDesc(
+			"mirakurun_epgstation_storage_available_bytes",
+			"Free space of the EPGStation storage.",
+			[]string{"host", "storage"},
+			nil),
+		storageUsed: newDesc(
+			"mirakurun_epgstation_storage_used_bytes",
+			"Used space of the EPGStation storage.",
+			[]string{"host", "storage"},
+			nil),
+		storageTotal: newDesc(
+			"mirakurun_epgstation_storage_total_bytes",
+			"Size of the EPGStation storage.",
+			[]string{"host", "storage"},
+			nil),
+	}
+}
+
+// Enabled reports whether the collector is configured to collect anything.
+func (ec *epgstationCollector) Enabled() bool {
+	return configured("EPGSTATION")
+}
+
+func (ec *epgstationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ec.up
+	ch <- ec.reserves
+	ch <- ec.recording
+	ch <- ec.recorded
+	ch <- ec.encodeRunning
+	ch <- ec.encodeWaiting
+	ch <- ec.storageAvailable
+	ch <- ec.storageUsed
+	ch <- ec.storageTotal
+}
+
+func (ec *epgstationCollector) Collect(ch chan<- prometheus.Metric) {
+	if !ec.Enabled() {
+		return
+	}
+
+	ctx := context.Background()
+	// ラベルはMirakurunのホストに揃える
+	host := newAPI().Host
+	api := lookupAPI("EPGSTATION", "8888")
+	page := "isHalfWidth=true&offset=0&limit=1"
+	halfWidth := "isHalfWidth=true"
+	up := 1.0
+	failed := func(err error) {
+		logError("epgstation", err)
+		up = 0
+	}
+
+	var counts EPGStationReserveCounts
+	if err := fetchJSON(ctx, &api, "reserves/cnts", &Query{}, &counts); err != nil {
+		failed(err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(ec.reserves, prometheus.GaugeValue, float64(counts.Normal), host, "normal")
+		ch <- prometheus.MustNewConstMetric(ec.reserves, prometheus.GaugeValue, float64(counts.Conflicts), host, "conflict")
+		ch <- prometheus.MustNewConstMetric(ec.reserves, prometheus.GaugeValue, float64(counts.Skips), host, "skip")
+		ch <- prometheus.MustNewConstMetric(ec.reserves, prometheus.GaugeValue, float64(counts.Overlaps), host, "overlap")
+	}
+
+	var recording EPGStationRecords
+	if err := fetchJSON(ctx, &api, "recording", &Query{Query: &page}, &recording); err != nil {
+		failed(err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(ec.recording, prometheus.GaugeValue, float64(recording.Total), host)
+	}
+
+	var recorded EPGStationRecords
+	if err := fetchJSON(ctx, &api, "recorded", &Query{Query: &page}, &recorded); err != nil {
+		failed(err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(ec.recorded, prometheus.GaugeValue, float64(recorded.Total), host)
+	}
+
+	var encode EPGStationEncode
+	if err := fetchJSON(ctx, &api, "encode", &Query{Query: &halfWidth}, &encode); err != nil {
+		failed(err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(ec.encodeRunning, prometheus.GaugeValue, float64(len(encode.RunningItems)), host)
+		ch <- prometheus.MustNewConstMetric(ec.encodeWaiting, prometheus.GaugeValue, float64(len(encode.WaitItems)), host)
+	}
+
+	var storages EPGStationStorages
+	if err := fetchJSON(ctx, &api, "storages", &Query{}, &storages); err != nil {
+		failed(err)
+	} else {
+		for _, s := range storages.Items {
+			ch <- prometheus.MustNewConstMetric(ec.storageAvailable, prometheus.GaugeValue, s.Available, host, s.Name)
+			ch <- prometheus.MustNewConstMetric(ec.storageUsed, prometheus.GaugeValue, s.Used, host, s.Name)
+			ch <- prometheus.MustNewConstMetric(ec.storageTotal, prometheus.GaugeValue, s.Total, host, s.Name)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(ec.up, prometheus.GaugeValue, up, host)
+}
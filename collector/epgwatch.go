@@ -0,0 +1,189 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// indexedProgram is what the EPG watcher remembers of a program between polls.
+type indexedProgram struct {
+	service  string
+	startAt  int64
+	duration int64
+}
+
+func (p indexedProgram) end() int64 {
+	return p.startAt + p.duration
+}
+
+type epgChanges struct {
+	rescheduled float64
+	removed     float64
+	extended    float64
+}
+
+type epgWatchCollector struct {
+	rescheduled *prometheus.Desc
+	removed     *prometheus.Desc
+	extended    *prometheus.Desc
+	lastPoll    *prometheus.Desc
+
+	enabled  bool
+	interval time.Duration
+
+	mu       sync.Mutex
+	index    map[int64]indexedProgram
+	changes  map[string]*epgChanges
+	lastTime time.Time
+	target   targetRoot
+}
+
+func NewEPGWatchCollector() *epgWatchCollector {
+	return &epgWatchCollector{
+		rescheduled: newDesc(
+			"mirakurun_epg_rescheduled_programs_total",
+			"Number of upcoming programs whose start time or duration changed in the EPG.",
+			[]string{"host", "service_id"},
+			nil),
+		removed: newDesc(
+			"mirakurun_epg_removed_programs_total",
+			"Number of programs removed from the EPG before they started.",
+			[]string{"host", "service_id"},
+			nil),
+		extended: newDesc(
+			"mirakurun_epg_extended_programs_total",
+			"Number of programs extended while on air.",
+			[]string{"host", "service_id"},
+			nil),
+		lastPoll: newDesc(
+			"mirakurun_epg_watch_last_poll_timestamp_seconds",
+			"Time of the last successful poll of /api/programs by the EPG watcher.",
+			[]string{"host"},
+			nil),
+		enabled:  lookupEnvBool("MIRAKURUN_EPG_WATCH"),
+		interval: LookupEnvDuration("MIRAKURUN_EPG_WATCH_INTERVAL", time.Minute),
+		changes:  make(map[string]*epgChanges),
+	}
+}
+
+// Enabled reports whether the collector is configured to collect anything.
+func (ec *epgWatchCollector) Enabled() bool {
+	return ec.enabled
+}
+
+func (ec *epgWatchCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ec.rescheduled
+	ch <- ec.removed
+	ch <- ec.extended
+	ch <- ec.lastPoll
+}
+
+func (ec *epgWatchCollector) Collect(ch chan<- prometheus.Metric) {
+	if !ec.enabled {
+		return
+	}
+	api := newAPI()
+
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	if ec.lastTime.IsZero() {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(ec.lastPoll, prometheus.GaugeValue, float64(ec.lastTime.Unix()), api.Host)
+	for service, c := range ec.changes {
+		ch <- prometheus.MustNewConstMetric(ec.rescheduled, prometheus.CounterValue, c.rescheduled, api.Host, service)
+		ch <- prometheus.MustNewConstMetric(ec.removed, prometheus.CounterValue, c.removed, api.Host, service)
+		ch <- prometheus.MustNewConstMetric(ec.extended, prometheus.CounterValue, c.extended, api.Host, service)
+	}
+}
+
+func (ec *epgWatchCollector) Run(ctx context.Context) {
+	if !ec.enabled {
+		return
+	}
+	for {
+		ec.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ec.interval):
+		}
+	}
+}
+
+func (ec *epgWatchCollector) poll(ctx context.Context) {
+	api := newAPI()
+	programs, err := fetchPrograms(ctx, &api)
+	if err != nil {
+		logBackgroundError("epg watch", err)
+		return
+	}
+
+	now := time.Now()
+	index := make(map[int64]indexedProgram, len(programs))
+	for i := range programs {
+		p := &programs[i]
+		index[p.ID] = indexedProgram{
+			service:  p.serviceKey().id(),
+			startAt:  p.StartAt,
+			duration: p.Duration,
+		}
+	}
+
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	// 別の Mirakurun の番組とは比べられない
+	if ec.target.changed(&api) {
+		ec.index = nil
+		ec.changes = make(map[string]*epgChanges)
+	}
+	for _, p := range index {
+		if ec.changes[p.service] == nil {
+			ec.changes[p.service] = &epgChanges{}
+		}
+	}
+	// 初回は比較対象がないので索引を作るだけ
+	if ec.index != nil {
+		ec.diff(index, now.UnixNano()/int64(time.Millisecond))
+	}
+	ec.index = index
+	ec.lastTime = now
+}
+
+// diff counts the changes from the previous index to the new one. now is in
+// milliseconds like the times in /api/programs.
+func (ec *epgWatchCollector) diff(index map[int64]indexedProgram, now int64) {
+	for id, old := range ec.index {
+		c := ec.changes[old.service]
+		if c == nil {
+			c = &epgChanges{}
+			ec.changes[old.service] = c
+		}
+
+		p, ok := index[id]
+		if !ok {
+			// 放送済みの番組が消えるのは通常の整理
+			if old.startAt > now {
+				c.removed++
+			}
+			continue
+		}
+		if p.startAt == old.startAt && p.duration == old.duration {
+			continue
+		}
+		if old.end() <= now {
+			continue
+		}
+		if old.startAt <= now && p.startAt == old.startAt && p.end() > old.end() {
+			c.extended++
+		} else {
+			c.rescheduled++
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package collector
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type forecastCollector struct {
+	demand   *prometheus.Desc
+	demandAt *prometheus.Desc
+	supply   *prometheus.Desc
+	free     *prometheus.Desc
+	shortage *prometheus.Desc
+
+	window time.Duration
+}
+
+func NewForecastCollector() *forecastCollector {
+	return &forecastCollector{
+		demand: newDesc(
+			"mirakurun_forecast_tuner_demand_max",
+			"Largest number of channels of the type airing programs at the same time within the forecast window.",
+			[]string{"host", "type"},
+			nil),
+		demandAt: newDesc(
+			"mirakurun_forecast_tuner_demand_max_timestamp_seconds",
+			"Start of the first period with the largest demand within the forecast window.",
+			[]string{"host", "type"},
+			nil),
+		supply: newDesc(
+			"mirakurun_forecast_tuner_supply",
+			"Number of available tuners supporting the type.",
+			[]string{"host", "type"},
+			nil),
+		free: newDesc(
+			"mirakurun_forecast_tuner_free",
+			"Number of currently free tuners supporting the type.",
+			[]string{"host", "type"},
+			nil),
+		shortage: newDesc(
+			"mirakurun_forecast_tuner_shortage",
+			"Whether the largest demand within the forecast window exceeds the supply.",
+			[]string{"host", "type"},
+			nil),
+		window: LookupEnvDuration("MIRAKURUN_FORECAST_WINDOW", 24*time.Hour),
+	}
+}
+
+func (fc *forecastCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- fc.demand
+	ch <- fc.demandAt
+	ch <- fc.supply
+	ch <- fc.free
+	ch <- fc.shortage
+}
+
+func (fc *forecastCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	api := newAPI()
+
+	var tuners []Tuner
+	if err := fetchJSON(ctx, &api, "tuners", &Query{}, &tuners); err != nil {
+		logError("forecast", err)
+		return
+	}
+	var services []Service
+	if err := fetchJSON(ctx, &api, "services", &Query{}, &services); err != nil {
+		logError("forecast", err)
+		return
+	}
+	programs, err := fetchPrograms(ctx, &api)
+	if err != nil {
+		logError("forecast", err)
+		return
+	}
+
+	// 複数の種別に対応するチューナーはそれぞれに数える
+	supply := make(map[string]float64)
+	free := make(map[string]float64)
+	for _, t := range tuners {
+		if !t.IsAvailable || t.IsFault {
+			continue
+		}
+		for _, typ := range t.Types {
+			supply[typ]++
+			if t.IsFree {
+				free[typ]++
+			}
+		}
+	}
+
+	now := time.Now()
+	demand := tunerDemand(programs, services, now, now.Add(fc.window))
+
+	types := make(map[string]bool)
+	for typ := range supply {
+		types[typ] = true
+	}
+	for typ := range demand {
+		types[typ] = true
+	}
+	for typ := range types {
+		d := demand[typ]
+		shortage := 0.0
+		if float64(d.max) > supply[typ] {
+			shortage = 1
+		}
+		ch <- prometheus.MustNewConstMetric(fc.demand, prometheus.GaugeValue, float64(d.max), api.Host, typ)
+		if d.max > 0 {
+			ch <- prometheus.MustNewConstMetric(fc.demandAt, prometheus.GaugeValue, float64(d.at.Unix()), api.Host, typ)
+		}
+		ch <- prometheus.MustNewConstMetric(fc.supply, prometheus.GaugeValue, supply[typ], api.Host, typ)
+		ch <- prometheus.MustNewConstMetric(fc.free, prometheus.GaugeValue, free[typ], api.Host, typ)
+		ch <- prometheus.MustNewConstMetric(fc.shortage, prometheus.GaugeValue, shortage, api.Host, typ)
+	}
+}
+
+type demandPeak struct {
+	max int
+	at  time.Time
+}
+
+type demandEdge struct {
+	at    time.Time
+	delta int
+}
+
+// tunerDemand returns, per channel type, the largest number of channels
+// airing at the same time between from and to. One tuner receives a whole
+// channel, so programs on the same channel need only one tuner.
+func tunerDemand(programs []Program, services []Service, from, to time.Time) map[string]demandPeak {
+	channels := make(map[serviceKey]Channel)
+	for _, s := range services {
+		channels[s.serviceKey()] = s.Channel
+	}
+
+	// チャンネル毎に放送中の区間をまとめる
+	type interval struct{ start, end time.Time }
+	busy := make(map[Channel][]interval)
+	for i := range programs {
+		p := &programs[i]
+		c, ok := channels[p.serviceKey()]
+		if !ok {
+			continue
+		}
+		start, end := p.start(), p.end()
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !start.Before(end) {
+			continue
+		}
+		busy[c] = append(busy[c], interval{start, end})
+	}
+
+	edges := make(map[string][]demandEdge)
+	for c, intervals := range busy {
+		sort.Slice(intervals, func(i, j int) bool { return intervals[i].start.Before(intervals[j].start) })
+		cur := intervals[0]
+		for _, iv := range intervals[1:] {
+			if !iv.start.After(cur.end) {
+				if iv.end.After(cur.end) {
+					cur.end = iv.end
+				}
+				continue
+			}
+			edges[c.Type] = append(edges[c.Type], demandEdge{cur.start, 1}, demandEdge{cur.end, -1})
+			cur = iv
+		}
+		edges[c.Type] = append(edges[c.Type], demandEdge{cur.start, 1}, demandEdge{cur.end, -1})
+	}
+
+	peaks := make(map[string]demandPeak)
+	for typ, e := range edges {
+		// 同時刻では終了を先に数える
+		sort.Slice(e, func(i, j int) bool {
+			if e[i].at.Equal(e[j].at) {
+				return e[i].delta < e[j].delta
+			}
+			return e[i].at.Before(e[j].at)
+		})
+		var peak demandPeak
+		n := 0
+		for _, edge := range e {
+			n += edge.delta
+			if n > peak.max {
+				peak = demandPeak{max: n, at: edge.at}
+			}
+		}
+		peaks[typ] = peak
+	}
+	return peaks
+}
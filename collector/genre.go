@@ -0,0 +1,170 @@
+package collector
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	programDurationBuckets = []float64{5 * 60, 15 * 60, 30 * 60, 60 * 60, 2 * 60 * 60, 3 * 60 * 60, 6 * 60 * 60}
+	programAdvanceBuckets  = []float64{60 * 60, 6 * 60 * 60, 12 * 60 * 60, 24 * 60 * 60, 2 * 24 * 60 * 60, 4 * 24 * 60 * 60, 7 * 24 * 60 * 60, 14 * 24 * 60 * 60}
+)
+
+// constHistogram accumulates observations for prometheus.MustNewConstHistogram.
+type constHistogram struct {
+	bounds  []float64
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+func newConstHistogram(bounds []float64) *constHistogram {
+	h := &constHistogram{bounds: bounds, buckets: make(map[float64]uint64)}
+	for _, b := range bounds {
+		h.buckets[b] = 0
+	}
+	return h
+}
+
+func (h *constHistogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	for _, b := range h.bounds {
+		if v <= b {
+			h.buckets[b]++
+		}
+	}
+}
+
+type genreKey struct {
+	service  string
+	lv1, lv2 int
+}
+
+type genreCollector struct {
+	duration *prometheus.Desc
+	genre    *prometheus.Desc
+	free     *prometheus.Desc
+	advance  *prometheus.Desc
+
+	// 番組が初めてEPGに現れた時刻。最初の取得で既にあった番組は
+	// いつ現れたか分からないのでゼロにしておき advance には数えない
+	mu        sync.Mutex
+	seeded    bool
+	firstSeen map[int64]time.Time
+	target    targetRoot
+}
+
+func NewGenreCollector() *genreCollector {
+	return &genreCollector{
+		duration: newDesc(
+			"mirakurun_programs_duration_seconds",
+			"Duration of the programs in the EPG per service.",
+			[]string{"host", "service_id"},
+			nil),
+		genre: newDesc(
+			"mirakurun_programs_genre",
+			"Number of programs in the EPG per service and ARIB genre.",
+			[]string{"host", "service_id", "lv1", "lv2", "genre"},
+			nil),
+		free: newDesc(
+			"mirakurun_programs",
+			"Number of programs in the EPG per service and free flag.",
+			[]string{"host", "service_id", "free"},
+			nil),
+		advance: newDesc(
+			"mirakurun_programs_advance_seconds",
+			"Time between the exporter first seeing an upcoming program in the EPG and its start. Programs already in the EPG at the first scrape are not counted.",
+			[]string{"host", "service_id"},
+			nil),
+		firstSeen: make(map[int64]time.Time),
+	}
+}
+
+func (gc *genreCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- gc.duration
+	ch <- gc.genre
+	ch <- gc.free
+	ch <- gc.advance
+}
+
+func (gc *genreCollector) Collect(ch chan<- prometheus.Metric) {
+	api := newAPI()
+	programs, err := fetchPrograms(context.Background(), &api)
+	if err != nil {
+		logError("genre", err)
+		return
+	}
+
+	now := time.Now()
+	durations := make(map[string]*constHistogram)
+	advances := make(map[string]*constHistogram)
+	genres := make(map[genreKey]float64)
+	free := make(map[string]float64)
+	paid := make(map[string]float64)
+
+	gc.mu.Lock()
+	if gc.target.changed(&api) {
+		gc.seeded = false
+		gc.firstSeen = make(map[int64]time.Time)
+	}
+	seen := make(map[int64]time.Time, len(programs))
+	for i := range programs {
+		p := &programs[i]
+		service := p.serviceKey().id()
+
+		first, ok := gc.firstSeen[p.ID]
+		if !ok && gc.seeded {
+			first = now
+		}
+		seen[p.ID] = first
+
+		if durations[service] == nil {
+			durations[service] = newConstHistogram(programDurationBuckets)
+			advances[service] = newConstHistogram(programAdvanceBuckets)
+		}
+		durations[service].observe(float64(p.Duration) / 1000)
+		if start := p.start(); start.After(now) && !first.IsZero() {
+			advances[service].observe(start.Sub(first).Seconds())
+		}
+
+		for _, g := range p.Genres {
+			genres[genreKey{service, g.Lv1, g.Lv2}]++
+		}
+		if p.IsFree {
+			free[service]++
+		} else {
+			paid[service]++
+		}
+	}
+	// EPGから消えた番組は忘れる
+	gc.firstSeen = seen
+	gc.seeded = true
+	gc.mu.Unlock()
+
+	services := make([]string, 0, len(durations))
+	for s := range durations {
+		services = append(services, s)
+	}
+	sort.Strings(services)
+	for _, s := range services {
+		d := durations[s]
+		ch <- prometheus.MustNewConstHistogram(gc.duration, d.count, d.sum, d.buckets, api.Host, s)
+		a := advances[s]
+		ch <- prometheus.MustNewConstHistogram(gc.advance, a.count, a.sum, a.buckets, api.Host, s)
+		ch <- prometheus.MustNewConstMetric(gc.free, prometheus.GaugeValue, free[s], api.Host, s, "true")
+		ch <- prometheus.MustNewConstMetric(gc.free, prometheus.GaugeValue, paid[s], api.Host, s, "false")
+	}
+	for k, n := range genres {
+		name := ""
+		if k.lv1 >= 0 && k.lv1 < len(genreNames) {
+			name = genreNames[k.lv1]
+		}
+		ch <- prometheus.MustNewConstMetric(gc.genre, prometheus.GaugeValue, n, api.Host, k.service, strconv.Itoa(k.lv1), strconv.Itoa(k.lv2), name)
+	}
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CollectorError is the last error a collector logged.
+type CollectorError struct {
+	Message string
+	Time    time.Time
+}
+
+type errorLog struct {
+	sync.Mutex
+	m map[string]CollectorError
+}
+
+func (l *errorLog) set(name string, err error) {
+	l.Lock()
+	l.m[name] = CollectorError{Message: err.Error(), Time: time.Now()}
+	l.Unlock()
+}
+
+func (l *errorLog) get(name string) (CollectorError, bool) {
+	l.Lock()
+	defer l.Unlock()
+	e, ok := l.m[name]
+	return e, ok
+}
+
+// 取得時のエラーと Run で動いている処理のエラーは分けて持つ
+var (
+	lastErrors       = &errorLog{m: make(map[string]CollectorError)}
+	backgroundErrors = &errorLog{m: make(map[string]CollectorError)}
+)
+
+// logError logs err of the named collector during Collect and keeps it for
+// LastError.
+func logError(name string, err error) {
+	slog.Warn("collect failed", "collector", name, "err", err)
+	lastErrors.set(name, err)
+}
+
+// logBackgroundError logs err of the work the named collector does in Run
+// and keeps it for LastBackgroundError.
+func logBackgroundError(name string, err error) {
+	slog.Warn("background task failed", "collector", name, "err", err)
+	backgroundErrors.set(name, err)
+}
+
+// LastError returns the last error the named collector logged in Collect.
+func LastError(name string) (CollectorError, bool) {
+	return lastErrors.get(name)
+}
+
+// LastBackgroundError returns the last error the named collector logged in
+// Run.
+func LastBackgroundError(name string) (CollectorError, bool) {
+	return backgroundErrors.get(name)
+}
@@ -1,13 +1,20 @@
 package collector
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 )
 
+var errNotFound = errors.New("not found")
+
 type ApiInfo struct {
 	Host   string
 	Port   string
@@ -18,54 +25,150 @@ type Query struct {
 }
 
 func newAPI() ApiInfo {
+	return lookupAPI("MIRAKURUN", "40772")
+}
+
+// lookupAPI reads <prefix>_HOST, <prefix>_PORT and <prefix>_SCHEMA. The
+// target configuration file takes precedence over them.
+func lookupAPI(prefix string, port string) ApiInfo {
 	apiInfo := new(ApiInfo)
+	configured := configuredAPI(prefix)
 
 	// Configure Host
-	h, e := os.LookupEnv("MIRAKURUN_HOST")
+	h, e := os.LookupEnv(prefix + "_HOST")
 	if !e {
 		h = "localhost"
 	}
+	if configured.Host != "" {
+		h = configured.Host
+	}
 	apiInfo.Host = h
 
 	// Configure Port
-	p, e := os.LookupEnv("MIRAKURUN_PORT")
+	p, e := os.LookupEnv(prefix + "_PORT")
 	if !e {
-		p = "40772"
+		p = port
+	}
+	if configured.Port != "" {
+		p = configured.Port
 	}
 	apiInfo.Port = p
 
 	// Configure Schema
-	s, e := os.LookupEnv("MIRAKURUN_SCHEMA")
+	s, e := os.LookupEnv(prefix + "_SCHEMA")
 	if !e {
 		s = "http"
 	}
+	if configured.Schema != "" {
+		s = configured.Schema
+	}
 	apiInfo.Schema = s
 
 	return *apiInfo
 }
 
+// LookupEnvDuration reads a duration such as "15m" from the environment and
+// exits when it is invalid.
+func LookupEnvDuration(key string, def time.Duration) time.Duration {
+	v, e := os.LookupEnv(key)
+	if !e {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		fatal("invalid environment variable", "key", key, "err", err)
+	}
+	return d
+}
+
+// lookupEnvBool reads a boolean such as "true" or "1" from the environment.
+func lookupEnvBool(key string) bool {
+	v, e := os.LookupEnv(key)
+	if !e {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		fatal("invalid environment variable", "key", key, "err", err)
+	}
+	return b
+}
+
+// fatal logs msg at error level and exits. It is only for configuration
+// errors found on startup.
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func getApiRoot(apiInfo *ApiInfo) string {
 	return fmt.Sprintf("%s://%s:%s/api/", apiInfo.Schema, apiInfo.Host, apiInfo.Port)
 }
 
-func fetch(apiInfo *ApiInfo, namespace string, query *Query) []byte {
+func newRequest(ctx context.Context, apiInfo *ApiInfo, namespace string, query *Query) (*http.Request, error) {
 	root := getApiRoot(apiInfo)
 	url := fmt.Sprintf("%s%s", root, namespace)
 	if query.Query != nil {
 		url = fmt.Sprintf("%s?%s", url, *query.Query)
 	}
 
+	return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+}
+
+func get(ctx context.Context, apiInfo *ApiInfo, namespace string, query *Query) (*http.Response, error) {
+	req, err := newRequest(ctx, apiInfo, namespace, query)
+	if err != nil {
+		return nil, err
+	}
+	return do(req, apiInfo, namespace)
+}
+
+func fetchBody(ctx context.Context, apiInfo *ApiInfo, namespace string, query *Query) ([]byte, error) {
 	// APIを叩く
-	res, err := http.Get(url)
+	res, err := get(ctx, apiInfo, namespace, query)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return readBody(res)
+}
 
+// readBody reads and closes the body of res. A 404 is reported as
+// errNotFound and any other non-2xx status as an error.
+func readBody(res *http.Response) ([]byte, error) {
 	defer res.Body.Close()
-	body, err := ioutil.ReadAll(res.Body)
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", res.Request.URL, errNotFound)
+	}
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s: %s", res.Request.URL, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+func fetchJSON(ctx context.Context, apiInfo *ApiInfo, namespace string, query *Query, v interface{}) error {
+	body, err := fetchBody(ctx, apiInfo, namespace, query)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	return json.Unmarshal(body, v)
+}
 
-	return body
+// unmarshalTolerant decodes body like json.Unmarshal, but only logs fields
+// whose type differs from v. Mirakurun compatible servers such as mirakc do
+// not always agree with Mirakurun on the payload.
+func unmarshalTolerant(namespace string, body []byte, v interface{}) error {
+	err := json.Unmarshal(body, v)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		slog.Warn("ignoring field of unexpected type", "endpoint", namespace, "err", err)
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+)
+
+// データ放送はEPGを持たない
+const serviceTypeData = 0xc0
+
+// LintProblem is a problem found in the Mirakurun configuration.
+type LintProblem struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// Lint checks the tuners and channels config of Mirakurun against each other
+// and against the channels and services Mirakurun is actually serving.
+func Lint(ctx context.Context) ([]LintProblem, error) {
+	api := newAPI()
+
+	var tuners []TunerConfig
+	if err := fetchJSON(ctx, &api, "config/tuners", &Query{}, &tuners); err != nil {
+		return nil, fmt.Errorf("config/tuners: %v", err)
+	}
+	var channels []ChannelConfig
+	if err := fetchJSON(ctx, &api, "config/channels", &Query{}, &channels); err != nil {
+		return nil, fmt.Errorf("config/channels: %v", err)
+	}
+	var served []Channel
+	if err := fetchJSON(ctx, &api, "channels", &Query{}, &served); err != nil {
+		return nil, fmt.Errorf("channels: %v", err)
+	}
+	var services []Service
+	if err := fetchJSON(ctx, &api, "services", &Query{}, &services); err != nil {
+		return nil, fmt.Errorf("services: %v", err)
+	}
+
+	var problems []LintProblem
+	add := func(check, format string, a ...interface{}) {
+		problems = append(problems, LintProblem{Check: check, Message: fmt.Sprintf(format, a...)})
+	}
+
+	types := make(map[string]bool)
+	for _, t := range tuners {
+		if t.IsDisabled {
+			continue
+		}
+		if t.Command == "" && t.DvbDevicePath == "" && t.RemoteMirakurunHost == "" {
+			add("tuner-without-command", "tuner %s has no command", t.Name)
+		}
+		for _, typ := range t.Types {
+			types[typ] = true
+		}
+	}
+
+	isServed := make(map[string]bool)
+	for _, c := range served {
+		isServed[c.Type+"/"+c.Channel] = true
+	}
+	isEnabled := make(map[string]bool)
+	for _, c := range channels {
+		if !c.IsDisabled {
+			isEnabled[c.Type+"/"+c.Channel] = true
+		}
+	}
+
+	defined := make(map[string]int)
+	for _, c := range channels {
+		key := c.Type + "/" + c.Channel
+		if c.ServiceID != 0 {
+			key = fmt.Sprintf("%s/%d", key, c.ServiceID)
+		}
+		defined[key]++
+		if defined[key] == 2 {
+			add("duplicate-channel", "channel %s is defined more than once", key)
+		}
+
+		if c.IsDisabled {
+			if isServed[c.Type+"/"+c.Channel] && !isEnabled[c.Type+"/"+c.Channel] {
+				add("disabled-channel-referenced", "channel %s (%s) is disabled but still served by mirakurun", key, c.Name)
+			}
+			continue
+		}
+		if !types[c.Type] {
+			add("unsupported-channel-type", "channel %s (%s) has type %s which no tuner supports", key, c.Name, c.Type)
+		}
+	}
+
+	for _, s := range services {
+		if s.Type != serviceTypeData && !s.EpgReady {
+			add("service-without-epg", "service %d (%s) on %s/%s has no EPG", s.ID, s.Name, s.Channel.Type, s.Channel.Channel)
+		}
+	}
+
+	return problems, nil
+}
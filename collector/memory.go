@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type rssSample struct {
+	at  time.Time
+	rss float64
+}
+
+// rssWindow keeps the RSS values observed by the exporter for a fixed
+// duration so that the growth rate can be derived across scrapes.
+type rssWindow struct {
+	mu      sync.Mutex
+	window  time.Duration
+	samples []rssSample
+}
+
+func newRSSWindow(window time.Duration) *rssWindow {
+	return &rssWindow{window: window}
+}
+
+// observe records rss and returns the growth rate in bytes per second over
+// the window. ok is false until two samples at different times are known.
+func (w *rssWindow) observe(at time.Time, rss float64) (rate float64, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples = append(w.samples, rssSample{at: at, rss: rss})
+
+	// 古いサンプルを捨てる
+	cutoff := at.Add(-w.window)
+	i := 0
+	for i < len(w.samples)-1 && w.samples[i].at.Before(cutoff) {
+		i++
+	}
+	w.samples = w.samples[i:]
+
+	first := w.samples[0]
+	last := w.samples[len(w.samples)-1]
+	span := last.at.Sub(first.at).Seconds()
+	if span <= 0 {
+		return 0, false
+	}
+	return (last.rss - first.rss) / span, true
+}
+
+// reset forgets every sample, e.g. after Mirakurun has restarted.
+func (w *rssWindow) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples = nil
+}
+
+type hostMemory struct {
+	Total     float64
+	Available float64
+}
+
+// readMeminfo parses MemTotal and MemAvailable from a /proc/meminfo style file.
+func readMeminfo(path string) (hostMemory, error) {
+	var mem hostMemory
+
+	f, err := os.Open(path)
+	if err != nil {
+		return mem, err
+	}
+	defer f.Close()
+
+	var total, available bool
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		// 単位はkB
+		if len(fields) == 3 && fields[2] == "kB" {
+			v *= 1024
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			mem.Total, total = v, true
+		case "MemAvailable:":
+			mem.Available, available = v, true
+		}
+	}
+	if err := s.Err(); err != nil {
+		return mem, err
+	}
+	if !total || !available {
+		return mem, fmt.Errorf("%s: MemTotal or MemAvailable not found", path)
+	}
+	return mem, nil
+}
@@ -0,0 +1,214 @@
+package collector
+
+import "math"
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	tsNullPID    = 0x1fff
+
+	// PCRは27MHz
+	pcrFrequency = 27000000
+	pcrWrap      = (1 << 33) * 300
+)
+
+type pcrSample struct {
+	packet uint64
+	pcr    float64
+}
+
+// tsStats is the result of analyzing an MPEG-TS stream.
+type tsStats struct {
+	Packets          uint64
+	SyncLosses       uint64
+	TransportErrors  uint64
+	Scrambled        uint64
+	ContinuityErrors map[uint16]uint64
+	// PCRJitter is the largest deviation in seconds of a PCR from the
+	// constant bitrate line fitted through all PCRs of its PID. It assumes
+	// the packets arrive as the multiplex was sent, so it is meaningless for
+	// a service stream Mirakurun has filtered packets out of.
+	PCRJitter float64
+}
+
+func (s tsStats) continuityErrors() uint64 {
+	var n uint64
+	for _, e := range s.ContinuityErrors {
+		n += e
+	}
+	return n
+}
+
+func (s tsStats) scrambledRatio() float64 {
+	if s.Packets == 0 {
+		return 0
+	}
+	return float64(s.Scrambled) / float64(s.Packets)
+}
+
+// tsAnalyzer inspects an MPEG-TS byte stream written into it.
+type tsAnalyzer struct {
+	buf      []byte
+	stats    tsStats
+	syncLost bool
+
+	// 直前のcontinuity_counter (PID毎)
+	lastCC map[uint16]byte
+	pcrs   map[uint16][]pcrSample
+}
+
+func newTSAnalyzer() *tsAnalyzer {
+	return &tsAnalyzer{
+		stats:  tsStats{ContinuityErrors: make(map[uint16]uint64)},
+		lastCC: make(map[uint16]byte),
+		pcrs:   make(map[uint16][]pcrSample),
+	}
+}
+
+// Write analyzes the complete packets in p. A packet is accepted only when
+// the next one starts with a sync byte as well, so a 0x47 in the payload is
+// not taken for a packet boundary and the last packet written is held back
+// until more data arrives.
+func (a *tsAnalyzer) Write(p []byte) (int, error) {
+	a.buf = append(a.buf, p...)
+
+	for {
+		// Resynchronize on the next sync byte followed by another one
+		i := 0
+		for ; i+tsPacketSize < len(a.buf); i++ {
+			if a.buf[i] == tsSyncByte && a.buf[i+tsPacketSize] == tsSyncByte {
+				break
+			}
+		}
+		if i > 0 && a.stats.Packets > 0 && !a.syncLost {
+			a.stats.SyncLosses++
+			a.syncLost = true
+		}
+		a.buf = a.buf[i:]
+
+		if len(a.buf) <= tsPacketSize {
+			break
+		}
+		a.syncLost = false
+		a.packet(a.buf[:tsPacketSize])
+		a.buf = a.buf[tsPacketSize:]
+	}
+
+	// Keep the remaining partial packet at the head of the buffer
+	a.buf = append(a.buf[:0:0], a.buf...)
+	return len(p), nil
+}
+
+func (a *tsAnalyzer) packet(pkt []byte) {
+	a.stats.Packets++
+
+	if pkt[1]&0x80 != 0 {
+		a.stats.TransportErrors++
+		// ヘッダーが信用できないので以降は見ない
+		return
+	}
+
+	pid := uint16(pkt[1]&0x1f)<<8 | uint16(pkt[2])
+	if pid == tsNullPID {
+		return
+	}
+
+	if pkt[3]>>6 != 0 {
+		a.stats.Scrambled++
+	}
+
+	afc := (pkt[3] >> 4) & 0x3
+	cc := pkt[3] & 0xf
+	hasPayload := afc&0x1 != 0
+	hasAdaptation := afc&0x2 != 0 && pkt[4] > 0
+	discontinuity := hasAdaptation && pkt[5]&0x80 != 0
+
+	if hasAdaptation && pkt[4] >= 7 && pkt[5]&0x10 != 0 {
+		if discontinuity {
+			a.pcrs[pid] = nil
+		}
+		a.pcr(pid, pkt[6:12])
+	}
+
+	if _, ok := a.stats.ContinuityErrors[pid]; !ok {
+		a.stats.ContinuityErrors[pid] = 0
+	}
+	last, seen := a.lastCC[pid]
+	if hasPayload {
+		a.lastCC[pid] = cc
+	}
+	if !seen || discontinuity || !hasPayload {
+		return
+	}
+	// 同じ値は重複パケットとして許容する
+	if cc != (last+1)&0xf && cc != last {
+		a.stats.ContinuityErrors[pid]++
+	}
+}
+
+func (a *tsAnalyzer) pcr(pid uint16, b []byte) {
+	base := uint64(b[0])<<25 | uint64(b[1])<<17 | uint64(b[2])<<9 | uint64(b[3])<<1 | uint64(b[4])>>7
+	ext := uint64(b[4]&0x1)<<8 | uint64(b[5])
+	pcr := float64(base*300 + ext)
+
+	samples := a.pcrs[pid]
+	if n := len(samples); n > 0 {
+		// Unwrap the 33 bit base
+		for pcr < samples[n-1].pcr-pcrWrap/2 {
+			pcr += pcrWrap
+		}
+	}
+	a.pcrs[pid] = append(samples, pcrSample{packet: a.stats.Packets, pcr: pcr})
+}
+
+// Stats returns what has been analyzed so far.
+func (a *tsAnalyzer) Stats() tsStats {
+	s := a.stats
+	s.PCRJitter = 0
+	for _, samples := range a.pcrs {
+		if j := pcrJitter(samples); j > s.PCRJitter {
+			s.PCRJitter = j
+		}
+	}
+	return s
+}
+
+// pcrJitter fits pcr = a + b*packet by least squares and returns the
+// largest residual in seconds.
+func pcrJitter(samples []pcrSample) float64 {
+	n := float64(len(samples))
+	if n < 3 {
+		return 0
+	}
+
+	// 桁落ちを避けるため平均からの差で計算する
+	var mx, my float64
+	for _, s := range samples {
+		mx += float64(s.packet)
+		my += s.pcr - samples[0].pcr
+	}
+	mx /= n
+	my /= n
+
+	var sxx, sxy float64
+	for _, s := range samples {
+		x := float64(s.packet) - mx
+		y := s.pcr - samples[0].pcr - my
+		sxx += x * x
+		sxy += x * y
+	}
+	if sxx == 0 {
+		return 0
+	}
+	b := sxy / sxx
+
+	var max float64
+	for _, s := range samples {
+		x := float64(s.packet) - mx
+		y := s.pcr - samples[0].pcr - my
+		if r := math.Abs(y - b*x); r > max {
+			max = r
+		}
+	}
+	return max / pcrFrequency
+}
@@ -0,0 +1,205 @@
+package collector
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testPacket struct {
+	pid           uint16
+	cc            byte
+	tei           bool
+	scrambled     bool
+	discontinuity bool
+	pcr           int64 // 27MHz, -1 for none
+}
+
+func (p testPacket) bytes() []byte {
+	b := bytes.Repeat([]byte{0xff}, tsPacketSize)
+	b[0] = tsSyncByte
+	b[1] = byte(p.pid >> 8 & 0x1f)
+	if p.tei {
+		b[1] |= 0x80
+	}
+	b[2] = byte(p.pid)
+	b[3] = 0x10 | p.cc&0xf
+	if p.scrambled {
+		b[3] |= 0x80
+	}
+	if p.discontinuity || p.pcr >= 0 {
+		b[3] |= 0x20
+		b[4] = 1
+		b[5] = 0
+		if p.discontinuity {
+			b[5] |= 0x80
+		}
+		if p.pcr >= 0 {
+			b[4] = 7
+			b[5] |= 0x10
+			base, ext := uint64(p.pcr)/300, uint64(p.pcr)%300
+			b[6] = byte(base >> 25)
+			b[7] = byte(base >> 17)
+			b[8] = byte(base >> 9)
+			b[9] = byte(base >> 1)
+			b[10] = byte(base&1)<<7 | 0x7e | byte(ext>>8)
+			b[11] = byte(ext)
+		}
+	}
+	return b
+}
+
+func pkt(pid uint16, cc byte) testPacket {
+	return testPacket{pid: pid, cc: cc, pcr: -1}
+}
+
+// analyze writes the stream in odd sized chunks, followed by a sync byte so
+// that the last packet is accepted.
+func analyze(stream []byte) tsStats {
+	a := newTSAnalyzer()
+	stream = append(stream, tsSyncByte)
+	for len(stream) > 0 {
+		n := 100
+		if n > len(stream) {
+			n = len(stream)
+		}
+		a.Write(stream[:n])
+		stream = stream[n:]
+	}
+	return a.Stats()
+}
+
+func packets(ps ...testPacket) []byte {
+	var b []byte
+	for _, p := range ps {
+		b = append(b, p.bytes()...)
+	}
+	return b
+}
+
+func TestTSAnalyzer(t *testing.T) {
+	withTEI := pkt(0x100, 7)
+	withTEI.tei = true
+	scrambled := pkt(0x100, 1)
+	scrambled.scrambled = true
+	discontinuity := pkt(0x100, 9)
+	discontinuity.discontinuity = true
+
+	truncated := pkt(0x100, 2).bytes()[:100]
+	// 0x47 を含むゴミを挟んでも次の188バイト先が同期バイトでなければ無視する
+	junk := append([]byte{0x00, tsSyncByte, 0x12}, bytes.Repeat([]byte{0x00}, 200)...)
+
+	tests := []struct {
+		name            string
+		stream          []byte
+		packets         uint64
+		syncLosses      uint64
+		transportErrors uint64
+		scrambled       uint64
+		ccErrors        uint64
+	}{
+		{
+			name:    "continuous",
+			stream:  packets(pkt(0x100, 14), pkt(0x100, 15), pkt(0x100, 0), pkt(0x100, 1)),
+			packets: 4,
+		},
+		{
+			name:     "cc gap",
+			stream:   packets(pkt(0x100, 0), pkt(0x100, 1), pkt(0x100, 3)),
+			packets:  3,
+			ccErrors: 1,
+		},
+		{
+			name:    "duplicate packet",
+			stream:  packets(pkt(0x100, 0), pkt(0x100, 1), pkt(0x100, 1), pkt(0x100, 2)),
+			packets: 4,
+		},
+		{
+			name:    "discontinuity flag",
+			stream:  packets(pkt(0x100, 0), pkt(0x100, 1), discontinuity, pkt(0x100, 10)),
+			packets: 4,
+		},
+		{
+			name:            "transport error indicator",
+			stream:          packets(pkt(0x100, 0), pkt(0x100, 1), withTEI, pkt(0x100, 2)),
+			packets:         4,
+			transportErrors: 1,
+		},
+		{
+			name:      "scrambling bits",
+			stream:    packets(pkt(0x100, 0), scrambled, pkt(0x100, 2), pkt(0x1fff, 0)),
+			packets:   4,
+			scrambled: 1,
+		},
+		{
+			name:    "null packets",
+			stream:  packets(pkt(0x100, 0), pkt(0x1fff, 5), pkt(0x1fff, 5), pkt(0x100, 1)),
+			packets: 4,
+		},
+		{
+			name:       "sync loss",
+			stream:     append(append(packets(pkt(0x100, 0), pkt(0x100, 1)), truncated...), packets(pkt(0x100, 3), pkt(0x100, 4))...),
+			packets:    4,
+			syncLosses: 1,
+			ccErrors:   1,
+		},
+		{
+			name:    "leading garbage",
+			stream:  append(append([]byte{}, junk...), packets(pkt(0x100, 0), pkt(0x100, 1))...),
+			packets: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := analyze(tt.stream)
+			if s.Packets != tt.packets {
+				t.Errorf("Packets = %d, want %d", s.Packets, tt.packets)
+			}
+			if s.SyncLosses != tt.syncLosses {
+				t.Errorf("SyncLosses = %d, want %d", s.SyncLosses, tt.syncLosses)
+			}
+			if s.TransportErrors != tt.transportErrors {
+				t.Errorf("TransportErrors = %d, want %d", s.TransportErrors, tt.transportErrors)
+			}
+			if s.Scrambled != tt.scrambled {
+				t.Errorf("Scrambled = %d, want %d", s.Scrambled, tt.scrambled)
+			}
+			if n := s.continuityErrors(); n != tt.ccErrors {
+				t.Errorf("continuity errors = %d, want %d", n, tt.ccErrors)
+			}
+		})
+	}
+}
+
+func TestTSAnalyzerPCR(t *testing.T) {
+	// 1パケットあたり 27MHz で 1000 進む固定レート
+	const step = 1000
+
+	tests := []struct {
+		name  string
+		start int64
+		shift map[int]int64
+		min   float64
+		max   float64
+	}{
+		{name: "constant", start: 0, max: 1e-9},
+		{name: "wrap", start: pcrWrap - 5*step, max: 1e-9},
+		{name: "jitter", start: 0, shift: map[int]int64{5: pcrFrequency / 1000}, min: 0.0005, max: 0.001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ps []testPacket
+			for i := 0; i < 10; i++ {
+				p := pkt(0x101, byte(i))
+				p.pcr = (tt.start + int64(i)*step + tt.shift[i]) % pcrWrap
+				ps = append(ps, p)
+			}
+			s := analyze(packets(ps...))
+			if s.PCRJitter < tt.min || s.PCRJitter > tt.max {
+				t.Errorf("PCRJitter = %g, want in [%g, %g]", s.PCRJitter, tt.min, tt.max)
+			}
+			if n := s.continuityErrors(); n != 0 {
+				t.Errorf("continuity errors = %d, want 0", n)
+			}
+		})
+	}
+}
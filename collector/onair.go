@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// JSON展開用
+type OnAir struct {
+	ServiceID int64 `json:"serviceId"`
+	// EIT[p/f] の現在と次の番組
+	Current struct {
+		Present   *Program `json:"present"`
+		Following *Program `json:"following"`
+	} `json:"current"`
+}
+
+type onairCollector struct {
+	present   *prometheus.Desc
+	info      *prometheus.Desc
+	endTime   *prometheus.Desc
+	remaining *prometheus.Desc
+}
+
+func NewOnAirCollector() *onairCollector {
+	return &onairCollector{
+		present: newDesc(
+			"mirakurun_service_onair_program_present",
+			"Whether the EPG has a program airing now on the service.",
+			[]string{"host", "service_id", "service_name"},
+			nil),
+		info: newDesc(
+			"mirakurun_service_onair_program_info",
+			"Program airing now on the service.",
+			[]string{"host", "service_id", "service_name", "program_name", "event_id", "genre"},
+			nil),
+		endTime: newDesc(
+			"mirakurun_service_onair_program_end_timestamp_seconds",
+			"End of the program airing now on the service.",
+			[]string{"host", "service_id"},
+			nil),
+		remaining: newDesc(
+			"mirakurun_service_onair_program_remaining_seconds",
+			"Time left until the program airing now on the service ends.",
+			[]string{"host", "service_id"},
+			nil),
+	}
+}
+
+func (oc *onairCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- oc.present
+	ch <- oc.info
+	ch <- oc.endTime
+	ch <- oc.remaining
+}
+
+func (oc *onairCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	api := newAPI()
+
+	var services []Service
+	if err := fetchJSON(ctx, &api, "services", &Query{}, &services); err != nil {
+		logError("onair", err)
+		return
+	}
+	now := time.Now()
+	current, err := currentPrograms(ctx, &api, now)
+	if err != nil {
+		logError("onair", err)
+		return
+	}
+
+	for _, s := range services {
+		if s.Type == serviceTypeData {
+			continue
+		}
+		id := strconv.FormatInt(s.ID, 10)
+		p, ok := current[s.ID]
+		if !ok {
+			ch <- prometheus.MustNewConstMetric(oc.present, prometheus.GaugeValue, 0, api.Host, id, s.Name)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(oc.present, prometheus.GaugeValue, 1, api.Host, id, s.Name)
+		ch <- prometheus.MustNewConstMetric(oc.info, prometheus.GaugeValue, 1, api.Host, id, s.Name, p.Name, strconv.Itoa(p.EventID), p.genre())
+		ch <- prometheus.MustNewConstMetric(oc.endTime, prometheus.GaugeValue, float64(p.end().Unix()), api.Host, id)
+		ch <- prometheus.MustNewConstMetric(oc.remaining, prometheus.GaugeValue, p.end().Sub(now).Seconds(), api.Host, id)
+	}
+}
+
+// currentPrograms returns the program airing at now keyed by the Mirakurun
+// service ID. mirakc answers it from EIT[p/f] on /api/onair, and services
+// without a present program there as well as Mirakurun are looked up in
+// /api/programs.
+func currentPrograms(ctx context.Context, api *ApiInfo, now time.Time) (map[int64]*Program, error) {
+	current := make(map[int64]*Program)
+
+	mirakc, err := isMirakc(ctx, api)
+	if err != nil {
+		return nil, err
+	}
+	if mirakc {
+		var onair []OnAir
+		if err := fetchJSON(ctx, api, "onair", &Query{}, &onair); err != nil {
+			return nil, err
+		}
+		complete := true
+		for _, o := range onair {
+			if o.Current.Present != nil {
+				current[o.ServiceID] = o.Current.Present
+			} else {
+				complete = false
+			}
+		}
+		if complete {
+			return current, nil
+		}
+	}
+
+	programs, err := fetchPrograms(ctx, api)
+	if err != nil {
+		return nil, err
+	}
+	for i := range programs {
+		p := &programs[i]
+		id := p.serviceKey().mirakurunID()
+		if _, ok := current[id]; ok {
+			continue
+		}
+		if !p.start().After(now) && p.end().After(now) {
+			current[id] = p
+		}
+	}
+	return current, nil
+}
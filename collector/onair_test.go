@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCurrentProgramsMirakc(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "mirakc/3.4.0")
+		w.Write([]byte(`{"current":"3.4.0","latest":"3.4.0"}`))
+	})
+	mux.HandleFunc("/api/onair", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/mirakc_onair.json")
+	})
+	// presentが無いサービスは/api/programsから探す
+	mux.HandleFunc("/api/programs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"id":327370103221000,"eventId":21000,"serviceId":1032,"networkId":32737,"startAt":1760870400000,"duration":3600000,"isFree":true,"name":"映画"},
+			{"id":327370103221001,"eventId":21001,"serviceId":1032,"networkId":32737,"startAt":1760874000000,"duration":3600000,"isFree":true,"name":"ドキュメンタリー"}
+		]`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	api := ApiInfo{Host: u.Hostname(), Port: u.Port(), Schema: u.Scheme}
+	now := time.Unix(0, 1760873000000*int64(time.Millisecond))
+
+	current, err := currentPrograms(context.Background(), &api, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 2 {
+		t.Errorf("got %d services, want 2", len(current))
+	}
+	for id, want := range map[int64]int{3273601024: 13218, 3273701032: 21000} {
+		p, ok := current[id]
+		if !ok {
+			t.Errorf("service %d: no program", id)
+			continue
+		}
+		if p.EventID != want {
+			t.Errorf("service %d: event %d, want %d", id, p.EventID, want)
+		}
+	}
+	if p := current[3273601024]; p != nil && p.genre() != "ニュース／報道" {
+		t.Errorf("genre = %q", p.genre())
+	}
+}
@@ -0,0 +1,375 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// probeTarget is either a channel or a single service to stream.
+type probeTarget struct {
+	Type      string
+	Channel   string
+	ServiceID int64
+}
+
+// serviceID returns the service_id label, which is empty for a channel.
+func (t probeTarget) serviceID() string {
+	if t.ServiceID == 0 {
+		return ""
+	}
+	return strconv.FormatInt(t.ServiceID, 10)
+}
+
+func (t probeTarget) namespace() string {
+	if t.ServiceID != 0 {
+		return fmt.Sprintf("services/%d/stream", t.ServiceID)
+	}
+	return fmt.Sprintf("channels/%s/%s/stream", t.Type, t.Channel)
+}
+
+type probeResult struct {
+	success           bool
+	timeToFirstPacket time.Duration
+	duration          time.Duration
+	bitrate           float64
+	stats             tsStats
+	timestamp         time.Time
+}
+
+type probeCollector struct {
+	success           *prometheus.Desc
+	timeToFirstPacket *prometheus.Desc
+	duration          *prometheus.Desc
+	bitrate           *prometheus.Desc
+	continuityErrors  *prometheus.Desc
+	pidContinuity     *prometheus.Desc
+	packets           *prometheus.Desc
+	syncLosses        *prometheus.Desc
+	transportErrors   *prometheus.Desc
+	pcrJitter         *prometheus.Desc
+	scrambledRatio    *prometheus.Desc
+	lastRun           *prometheus.Desc
+
+	enabled  bool
+	interval time.Duration
+	length   time.Duration
+	timeout  time.Duration
+	channels string
+
+	mu      sync.Mutex
+	results map[probeTarget]probeResult
+	target  targetRoot
+}
+
+func NewProbeCollector() *probeCollector {
+	labels := []string{"host", "type", "channel", "service_id"}
+	return &probeCollector{
+		success: newDesc(
+			"mirakurun_probe_success",
+			"Whether the last stream probe received MPEG-TS for the whole probe duration.",
+			labels,
+			nil),
+		timeToFirstPacket: newDesc(
+			"mirakurun_probe_time_to_first_packet_seconds",
+			"Time from the stream request to the first MPEG-TS packet in the last probe.",
+			labels,
+			nil),
+		duration: newDesc(
+			"mirakurun_probe_duration_seconds",
+			"Duration of the last stream probe.",
+			labels,
+			nil),
+		bitrate: newDesc(
+			"mirakurun_probe_bitrate_bits_per_second",
+			"Bitrate of the stream received in the last probe.",
+			labels,
+			nil),
+		continuityErrors: newDesc(
+			"mirakurun_probe_continuity_errors",
+			"MPEG-TS continuity counter errors seen in the last probe.",
+			labels,
+			nil),
+		pidContinuity: newDesc(
+			"mirakurun_probe_pid_continuity_errors",
+			"MPEG-TS continuity counter errors per PID seen in the last probe.",
+			append(labels, "pid"),
+			nil),
+		packets: newDesc(
+			"mirakurun_probe_packets",
+			"MPEG-TS packets received in the last probe.",
+			labels,
+			nil),
+		syncLosses: newDesc(
+			"mirakurun_probe_sync_losses",
+			"Times the sync byte was lost in the last probe.",
+			labels,
+			nil),
+		transportErrors: newDesc(
+			"mirakurun_probe_transport_errors",
+			"Packets with the transport error indicator set in the last probe.",
+			labels,
+			nil),
+		pcrJitter: newDesc(
+			"mirakurun_probe_pcr_jitter_seconds",
+			"Largest PCR deviation from a constant bitrate in the last probe. Not exported for service targets.",
+			labels,
+			nil),
+		scrambledRatio: newDesc(
+			"mirakurun_probe_scrambled_ratio",
+			"Ratio of scrambled packets in the last probe.",
+			labels,
+			nil),
+		lastRun: newDesc(
+			"mirakurun_probe_last_run_timestamp_seconds",
+			"Time the last stream probe finished.",
+			labels,
+			nil),
+
+		enabled:  lookupEnvBool("MIRAKURUN_PROBE"),
+		interval: LookupEnvDuration("MIRAKURUN_PROBE_INTERVAL", 30*time.Minute),
+		length:   LookupEnvDuration("MIRAKURUN_PROBE_DURATION", 5*time.Second),
+		timeout:  LookupEnvDuration("MIRAKURUN_PROBE_TIMEOUT", 20*time.Second),
+		channels: os.Getenv("MIRAKURUN_PROBE_CHANNELS"),
+		results:  make(map[probeTarget]probeResult),
+	}
+}
+
+// Enabled reports whether the collector is configured to collect anything.
+func (pc *probeCollector) Enabled() bool {
+	return pc.enabled
+}
+
+func (pc *probeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pc.success
+	ch <- pc.timeToFirstPacket
+	ch <- pc.duration
+	ch <- pc.bitrate
+	ch <- pc.continuityErrors
+	ch <- pc.pidContinuity
+	ch <- pc.packets
+	ch <- pc.syncLosses
+	ch <- pc.transportErrors
+	ch <- pc.pcrJitter
+	ch <- pc.scrambledRatio
+	ch <- pc.lastRun
+}
+
+func (pc *probeCollector) Collect(ch chan<- prometheus.Metric) {
+	api := newAPI()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.resetOnTargetChange(&api)
+	for t, r := range pc.results {
+		sid := t.serviceID()
+		success := 0.0
+		if r.success {
+			success = 1
+		}
+		ch <- prometheus.MustNewConstMetric(pc.success, prometheus.GaugeValue, success, api.Host, t.Type, t.Channel, sid)
+		ch <- prometheus.MustNewConstMetric(pc.duration, prometheus.GaugeValue, r.duration.Seconds(), api.Host, t.Type, t.Channel, sid)
+		ch <- prometheus.MustNewConstMetric(pc.lastRun, prometheus.GaugeValue, float64(r.timestamp.Unix()), api.Host, t.Type, t.Channel, sid)
+		if r.timeToFirstPacket > 0 {
+			ch <- prometheus.MustNewConstMetric(pc.timeToFirstPacket, prometheus.GaugeValue, r.timeToFirstPacket.Seconds(), api.Host, t.Type, t.Channel, sid)
+			ch <- prometheus.MustNewConstMetric(pc.bitrate, prometheus.GaugeValue, r.bitrate, api.Host, t.Type, t.Channel, sid)
+			pc.collectStats(ch, &api, t, &r.stats)
+		}
+	}
+}
+
+func (pc *probeCollector) collectStats(ch chan<- prometheus.Metric, api *ApiInfo, t probeTarget, s *tsStats) {
+	sid := t.serviceID()
+	ch <- prometheus.MustNewConstMetric(pc.continuityErrors, prometheus.GaugeValue, float64(s.continuityErrors()), api.Host, t.Type, t.Channel, sid)
+	for pid, n := range s.ContinuityErrors {
+		ch <- prometheus.MustNewConstMetric(pc.pidContinuity, prometheus.GaugeValue, float64(n), api.Host, t.Type, t.Channel, sid, fmt.Sprintf("0x%04x", pid))
+	}
+	ch <- prometheus.MustNewConstMetric(pc.packets, prometheus.GaugeValue, float64(s.Packets), api.Host, t.Type, t.Channel, sid)
+	ch <- prometheus.MustNewConstMetric(pc.syncLosses, prometheus.GaugeValue, float64(s.SyncLosses), api.Host, t.Type, t.Channel, sid)
+	ch <- prometheus.MustNewConstMetric(pc.transportErrors, prometheus.GaugeValue, float64(s.TransportErrors), api.Host, t.Type, t.Channel, sid)
+	// サービス単位のストリームは他のサービスのパケットが抜かれていて
+	// パケット数を時間軸にできないので出さない
+	if t.ServiceID == 0 {
+		ch <- prometheus.MustNewConstMetric(pc.pcrJitter, prometheus.GaugeValue, s.PCRJitter, api.Host, t.Type, t.Channel, sid)
+	}
+	ch <- prometheus.MustNewConstMetric(pc.scrambledRatio, prometheus.GaugeValue, s.scrambledRatio(), api.Host, t.Type, t.Channel, sid)
+}
+
+// resetOnTargetChange drops the results of another Mirakurun. pc.mu must be
+// held.
+func (pc *probeCollector) resetOnTargetChange(api *ApiInfo) {
+	if pc.target.changed(api) {
+		pc.results = make(map[probeTarget]probeResult)
+	}
+}
+
+// Run probes every target once per MIRAKURUN_PROBE_INTERVAL until ctx is done
+// when MIRAKURUN_PROBE is enabled, and returns immediately otherwise.
+func (pc *probeCollector) Run(ctx context.Context) {
+	if !pc.enabled {
+		return
+	}
+	for {
+		api := newAPI()
+		pc.probeAll(ctx)
+
+		// 接続先が変わったら次の間隔を待たずに新しい方を測る
+		wait, cancel := context.WithTimeout(ctx, pc.interval)
+		waitTargetChange(wait, api)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (pc *probeCollector) probeAll(ctx context.Context) {
+	api := newAPI()
+	targets, err := pc.targets(ctx, &api)
+	if err != nil {
+		logBackgroundError("probe", err)
+		return
+	}
+
+	// 同時に複数のチューナーを占有しないよう順番に行う
+	for _, t := range targets {
+		r := pc.probe(ctx, &api, t)
+		if ctx.Err() != nil {
+			return
+		}
+		// 途中で接続先が変わったら古い結果は捨てる
+		if newAPI() != api {
+			return
+		}
+		pc.mu.Lock()
+		pc.resetOnTargetChange(&api)
+		pc.results[t] = r
+		pc.mu.Unlock()
+	}
+}
+
+// targets parses MIRAKURUN_PROBE_CHANNELS, a comma separated list of
+// "type/channel" or service IDs. When unset, the first channel of every
+// type supported by a tuner is used.
+func (pc *probeCollector) targets(ctx context.Context, api *ApiInfo) ([]probeTarget, error) {
+	if pc.channels != "" {
+		var targets []probeTarget
+		for _, s := range strings.Split(pc.channels, ",") {
+			s = strings.TrimSpace(s)
+			if i := strings.Index(s, "/"); i >= 0 {
+				targets = append(targets, probeTarget{Type: s[:i], Channel: s[i+1:]})
+				continue
+			}
+			id, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("MIRAKURUN_PROBE_CHANNELS: %v", err)
+			}
+			var service Service
+			if err := fetchJSON(ctx, api, fmt.Sprintf("services/%d", id), &Query{}, &service); err != nil {
+				return nil, err
+			}
+			targets = append(targets, probeTarget{Type: service.Channel.Type, Channel: service.Channel.Channel, ServiceID: id})
+		}
+		return targets, nil
+	}
+
+	var tuners []Tuner
+	if err := fetchJSON(ctx, api, "tuners", &Query{}, &tuners); err != nil {
+		return nil, err
+	}
+	var channels []Channel
+	if err := fetchJSON(ctx, api, "channels", &Query{}, &channels); err != nil {
+		return nil, err
+	}
+
+	types := make(map[string]bool)
+	for _, t := range tuners {
+		for _, typ := range t.Types {
+			types[typ] = true
+		}
+	}
+	var targets []probeTarget
+	for _, c := range channels {
+		if types[c.Type] {
+			targets = append(targets, probeTarget{Type: c.Type, Channel: c.Channel})
+			delete(types, c.Type)
+		}
+	}
+	return targets, nil
+}
+
+func (pc *probeCollector) probe(ctx context.Context, api *ApiInfo, t probeTarget) (r probeResult) {
+	start := time.Now()
+	defer func() {
+		r.duration = time.Since(start)
+		r.timestamp = time.Now()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, pc.timeout)
+	defer cancel()
+
+	query := "decode=1"
+	req, err := newRequest(ctx, api, t.namespace(), &Query{Query: &query})
+	if err != nil {
+		logBackgroundError("probe", err)
+		return r
+	}
+	// 録画の邪魔をしないよう最低の優先度で受信する
+	req.Header.Set("X-Mirakurun-Priority", "-1")
+
+	res, err := do(req, api, t.namespace())
+	if err != nil {
+		logBackgroundError("probe", err)
+		return r
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		logBackgroundError("probe", fmt.Errorf("%s/%s: %s", t.Type, t.Channel, res.Status))
+		return r
+	}
+
+	ts := newTSAnalyzer()
+	buf := make([]byte, tsPacketSize*256)
+	var first time.Time
+	var received int
+	for {
+		n, err := res.Body.Read(buf)
+		ts.Write(buf[:n])
+		if first.IsZero() && ts.stats.Packets > 0 {
+			first = time.Now()
+			r.timeToFirstPacket = first.Sub(start)
+		}
+		if !first.IsZero() {
+			received += n
+			if elapsed := time.Since(first); elapsed >= pc.length {
+				r.success = true
+				r.bitrate = float64(received*8) / elapsed.Seconds()
+				break
+			}
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			// 終了時に打ち切ったものはエラーにしない
+			if ctx.Err() == nil {
+				logBackgroundError("probe", fmt.Errorf("%s/%s: %w", t.Type, t.Channel, err))
+			}
+			if !first.IsZero() {
+				r.bitrate = float64(received*8) / time.Since(first).Seconds()
+			}
+			break
+		}
+	}
+	r.stats = ts.Stats()
+	return r
+}
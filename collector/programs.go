@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ARIB STD-B10 のジャンル大分類
+var genreNames = [16]string{
+	"ニュース／報道",
+	"スポーツ",
+	"情報／ワイドショー",
+	"ドラマ",
+	"音楽",
+	"バラエティ",
+	"映画",
+	"アニメ／特撮",
+	"ドキュメンタリー／教養",
+	"劇場／公演",
+	"趣味／教育",
+	"福祉",
+	"予備",
+	"予備",
+	"拡張",
+	"その他",
+}
+
+// JSON展開用
+type Program struct {
+	ID        int64  `json:"id"`
+	EventID   int    `json:"eventId"`
+	ServiceID int    `json:"serviceId"`
+	NetworkID int    `json:"networkId"`
+	StartAt   int64  `json:"startAt"`
+	Duration  int64  `json:"duration"`
+	IsFree    bool   `json:"isFree"`
+	Name      string `json:"name"`
+	Genres    []struct {
+		Lv1 int `json:"lv1"`
+		Lv2 int `json:"lv2"`
+		Un1 int `json:"un1"`
+		Un2 int `json:"un2"`
+	} `json:"genres"`
+}
+
+// JSON展開用
+type Tuner struct {
+	Index       int         `json:"index"`
+	Name        string      `json:"name"`
+	Types       []string    `json:"types"`
+	Command     string      `json:"command"`
+	Pid         int         `json:"pid"`
+	Users       []TunerUser `json:"users"`
+	IsAvailable bool        `json:"isAvailable"`
+	IsRemote    bool        `json:"isRemote"`
+	IsFree      bool        `json:"isFree"`
+	IsUsing     bool        `json:"isUsing"`
+	IsFault     bool        `json:"isFault"`
+}
+
+// JSON展開用
+type TunerUser struct {
+	ID            string `json:"id"`
+	Priority      int    `json:"priority"`
+	Agent         string `json:"agent"`
+	StreamSetting struct {
+		Channel *Channel `json:"channel"`
+	} `json:"streamSetting"`
+}
+
+// JSON展開用
+type Channel struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	Name    string `json:"name"`
+}
+
+// JSON展開用
+type Service struct {
+	ID        int64   `json:"id"`
+	ServiceID int     `json:"serviceId"`
+	NetworkID int     `json:"networkId"`
+	Name      string  `json:"name"`
+	Type      int     `json:"type"`
+	EpgReady  bool    `json:"epgReady"`
+	Channel   Channel `json:"channel"`
+}
+
+// genre returns the name of the first major genre of the program, or "" if
+// it has none.
+func (p *Program) genre() string {
+	if len(p.Genres) == 0 || p.Genres[0].Lv1 < 0 || p.Genres[0].Lv1 >= len(genreNames) {
+		return ""
+	}
+	return genreNames[p.Genres[0].Lv1]
+}
+
+func (p *Program) start() time.Time {
+	return time.Unix(0, p.StartAt*int64(time.Millisecond))
+}
+
+func (p *Program) end() time.Time {
+	return p.start().Add(time.Duration(p.Duration) * time.Millisecond)
+}
+
+type serviceKey struct {
+	NetworkID int
+	ServiceID int
+}
+
+func (p *Program) serviceKey() serviceKey {
+	return serviceKey{NetworkID: p.NetworkID, ServiceID: p.ServiceID}
+}
+
+// mirakurunID returns the service ID as Mirakurun numbers it in
+// /api/services.
+func (k serviceKey) mirakurunID() int64 {
+	return int64(k.NetworkID)*100000 + int64(k.ServiceID)
+}
+
+func (k serviceKey) id() string {
+	return strconv.FormatInt(k.mirakurunID(), 10)
+}
+
+func (s *Service) serviceKey() serviceKey {
+	return serviceKey{NetworkID: s.NetworkID, ServiceID: s.ServiceID}
+}
+
+// programCache keeps /api/programs, which can be several megabytes, for a
+// short time so that the collectors reading it fetch it once per scrape.
+type programCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	root     string
+	fetched  time.Time
+	programs []Program
+}
+
+var programs = &programCache{ttl: 10 * time.Second}
+
+func (c *programCache) get(ctx context.Context, api *ApiInfo) ([]Program, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	root := getApiRoot(api)
+	if c.root == root && time.Since(c.fetched) < c.ttl {
+		return c.programs, nil
+	}
+
+	var p []Program
+	if err := fetchJSON(ctx, api, "programs", &Query{}, &p); err != nil {
+		return nil, err
+	}
+	c.root = root
+	c.fetched = time.Now()
+	c.programs = p
+	return p, nil
+}
+
+// fetchPrograms returns /api/programs. The result is shared between
+// callers and must not be modified.
+func fetchPrograms(ctx context.Context, api *ApiInfo) ([]Program, error) {
+	return programs.get(ctx, api)
+}
@@ -0,0 +1,201 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// restartTracker detects Mirakurun restarts by comparing consecutive
+// /api/status responses.
+type restartTracker struct {
+	mu        sync.Mutex
+	seen      bool
+	pid       int
+	errors    []int
+	startTime float64
+	restarts  float64
+}
+
+// errorCounts returns Mirakurun's internal counters, which start over from
+// zero whenever the process restarts.
+func errorCounts(status *Status) []int {
+	e := status.ErrorCount
+	return []int{
+		e.UncaughtException,
+		e.UnhandledRejection,
+		e.BufferOverflow,
+		e.TunerDeviceRespawn,
+		e.DecoderRespawn,
+	}
+}
+
+// observe feeds a status into the tracker and reports whether it belongs to
+// a process other than the previously observed one.
+func (t *restartTracker) observe(status *Status) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := float64(status.Time) / 1000
+	counts := errorCounts(status)
+
+	if !t.seen {
+		t.seen = true
+		t.pid = status.Process.Pid
+		t.errors = counts
+		t.startTime = now
+		return false
+	}
+
+	restarted := status.Process.Pid != t.pid
+	for i, c := range counts {
+		if c < t.errors[i] {
+			restarted = true
+		}
+	}
+	t.pid = status.Process.Pid
+	t.errors = counts
+	if restarted {
+		t.restarts++
+		t.startTime = now
+	}
+	return restarted
+}
+
+// reset forgets the process seen so far, for a new target.
+func (t *restartTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seen = false
+	t.pid = 0
+	t.errors = nil
+	t.startTime = 0
+	t.restarts = 0
+}
+
+// values returns the start time in seconds of the current process as first
+// seen by the exporter and the number of restarts detected so far.
+func (t *restartTracker) values() (startTime, restarts float64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.startTime, t.restarts, t.seen
+}
+
+// eventsWatcher keeps /api/events/stream open. Mirakurun closes the stream
+// when it goes down, so a drop triggers a status check as soon as Mirakurun
+// answers again instead of waiting for the next scrape.
+type eventsWatcher struct {
+	mu          sync.Mutex
+	connected   bool
+	disconnects float64
+}
+
+func (w *eventsWatcher) run(ctx context.Context, check func(context.Context) error) {
+	dropped := false
+	backoff := time.Second
+	for {
+		if dropped && check(ctx) == nil {
+			dropped = false
+		}
+
+		connected, err := w.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errTargetChanged) {
+			slog.Info("reconnecting events stream to the new target")
+			dropped = false
+			backoff = time.Second
+			continue
+		}
+		slog.Warn("events stream closed", "err", err)
+		dropped = dropped || connected
+		if connected {
+			backoff = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+var errTargetChanged = errors.New("target changed")
+
+func (w *eventsWatcher) watch(ctx context.Context) (bool, error) {
+	api := newAPI()
+
+	// 設定の再読み込みで接続先が変わったら張り直す
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changed := make(chan struct{})
+	go func() {
+		if waitTargetChange(ctx, api) {
+			close(changed)
+			cancel()
+		}
+	}()
+	targetChanged := func() bool {
+		select {
+		case <-changed:
+			return true
+		default:
+			return false
+		}
+	}
+
+	res, err := get(ctx, &api, "events/stream", &Query{})
+	if err != nil {
+		if targetChanged() {
+			return false, errTargetChanged
+		}
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return false, fmt.Errorf("events/stream: %s", res.Status)
+	}
+
+	w.setConnected(true)
+	_, err = io.Copy(ioutil.Discard, res.Body)
+	if targetChanged() {
+		// 自分で切ったものは切断として数えない
+		w.mu.Lock()
+		w.connected = false
+		w.mu.Unlock()
+		return true, errTargetChanged
+	}
+	w.setConnected(false)
+	if err == nil {
+		err = io.EOF
+	}
+	return true, err
+}
+
+func (w *eventsWatcher) setConnected(connected bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.connected && !connected {
+		w.disconnects++
+	}
+	w.connected = connected
+}
+
+func (w *eventsWatcher) values() (connected, disconnects float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.connected {
+		connected = 1
+	}
+	return connected, w.disconnects
+}
@@ -0,0 +1,254 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// signalConfig is read from MIRAKURUN_SIGNAL_CONFIG. Tuners are keyed by the
+// name in Mirakurun's tuners config, e.g.
+//
+//	{
+//	  "tuners": {
+//	    "PX-Q3PE_GR0": {"command": "checksignal --device /dev/px4video2 <channel>"},
+//	    "PT3-S0": {"file": "/sys/class/pt3/pt3video0/cnr", "scale": 0.01}
+//	  }
+//	}
+type signalConfig struct {
+	Timeout string                        `json:"timeout"`
+	Tuners  map[string]signalSourceConfig `json:"tuners"`
+}
+
+type signalSourceConfig struct {
+	// command is run with sh -c. <name>, <type> and <channel> are replaced
+	// like in Mirakurun's tuners config.
+	Command string `json:"command"`
+	File    string `json:"file"`
+	// pattern picks the value out of the output. The first submatch is used
+	// if there is one, otherwise the whole match.
+	Pattern string  `json:"pattern"`
+	Scale   float64 `json:"scale"`
+}
+
+// signalSource reads the C/N ratio of a tuner.
+type signalSource interface {
+	read(ctx context.Context, tuner *Tuner, channel *Channel) (string, error)
+	// needsChannel reports whether the source can only be read while the
+	// tuner is receiving a channel.
+	needsChannel() bool
+}
+
+type commandSignalSource struct {
+	command string
+}
+
+func (s commandSignalSource) read(ctx context.Context, tuner *Tuner, channel *Channel) (string, error) {
+	r := strings.NewReplacer(
+		"<name>", tuner.Name,
+		"<type>", channel.Type,
+		"<channel>", channel.Channel,
+	)
+	out, err := exec.CommandContext(ctx, "sh", "-c", r.Replace(s.command)).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func (s commandSignalSource) needsChannel() bool {
+	return strings.Contains(s.command, "<channel>")
+}
+
+type fileSignalSource struct {
+	path string
+}
+
+func (s fileSignalSource) read(ctx context.Context, tuner *Tuner, channel *Channel) (string, error) {
+	b, err := ioutil.ReadFile(s.path)
+	return string(b), err
+}
+
+func (s fileSignalSource) needsChannel() bool {
+	return false
+}
+
+type signalReader struct {
+	source  signalSource
+	pattern *regexp.Regexp
+	scale   float64
+}
+
+var defaultSignalPattern = regexp.MustCompile(`-?[0-9]+(?:\.[0-9]+)?`)
+
+func (r *signalReader) read(ctx context.Context, tuner *Tuner, channel *Channel) (float64, error) {
+	out, err := r.source.read(ctx, tuner, channel)
+	if err != nil {
+		return 0, err
+	}
+
+	// checksignalは何行も出力するので最後の値を使う
+	matches := r.pattern.FindAllStringSubmatch(out, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("no value in %q", strings.TrimSpace(out))
+	}
+	m := matches[len(matches)-1]
+	v := m[0]
+	if len(m) > 1 {
+		v = m[1]
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, err
+	}
+	return f * r.scale, nil
+}
+
+type signalCollector struct {
+	cnr *prometheus.Desc
+	up  *prometheus.Desc
+
+	timeout time.Duration
+	readers map[string]*signalReader
+}
+
+func NewSignalCollector() *signalCollector {
+	sc := &signalCollector{
+		cnr: newDesc(
+			"mirakurun_tuner_signal_cnr_db",
+			"C/N ratio of the tuner in dB.",
+			[]string{"host", "tuner", "channel"},
+			nil),
+		up: newDesc(
+			"mirakurun_tuner_signal_up",
+			"Whether the C/N ratio of the tuner could be read.",
+			[]string{"host", "tuner"},
+			nil),
+		timeout: 5 * time.Second,
+		readers: make(map[string]*signalReader),
+	}
+
+	path, ok := os.LookupEnv("MIRAKURUN_SIGNAL_CONFIG")
+	if !ok {
+		return sc
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatal("failed to read signal config", "err", err)
+	}
+	var config signalConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		fatal("invalid signal config", "path", path, "err", err)
+	}
+	if config.Timeout != "" {
+		if sc.timeout, err = time.ParseDuration(config.Timeout); err != nil {
+			fatal("invalid signal config", "path", path, "err", err)
+		}
+	}
+	for name, c := range config.Tuners {
+		r := &signalReader{pattern: defaultSignalPattern, scale: 1}
+		switch {
+		case c.Command != "":
+			r.source = commandSignalSource{command: c.Command}
+		case c.File != "":
+			r.source = fileSignalSource{path: c.File}
+		default:
+			fatal("invalid signal config: tuner has neither command nor file", "path", path, "tuner", name)
+		}
+		if c.Pattern != "" {
+			if r.pattern, err = regexp.Compile(c.Pattern); err != nil {
+				fatal("invalid signal config", "path", path, "tuner", name, "err", err)
+			}
+		}
+		if c.Scale != 0 {
+			r.scale = c.Scale
+		}
+		sc.readers[name] = r
+	}
+	return sc
+}
+
+// Enabled reports whether the collector is configured to collect anything.
+func (sc *signalCollector) Enabled() bool {
+	return len(sc.readers) > 0
+}
+
+func (sc *signalCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.cnr
+	ch <- sc.up
+}
+
+func (sc *signalCollector) Collect(ch chan<- prometheus.Metric) {
+	if len(sc.readers) == 0 {
+		return
+	}
+
+	api := newAPI()
+	var tuners []Tuner
+	if err := fetchJSON(context.Background(), &api, "tuners", &Query{}, &tuners); err != nil {
+		logError("signal", err)
+		return
+	}
+
+	// コマンドは時間がかかることがあるのでチューナーごとに並行して読む
+	type result struct {
+		tuner   string
+		channel string
+		cnr     float64
+		err     error
+	}
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := range tuners {
+		tuner := &tuners[i]
+		r, ok := sc.readers[tuner.Name]
+		if !ok {
+			continue
+		}
+
+		// 受信中のチャンネルをラベルにする
+		channel := &Channel{}
+		for _, u := range tuner.Users {
+			if u.StreamSetting.Channel != nil {
+				channel = u.StreamSetting.Channel
+				break
+			}
+		}
+		if channel.Channel == "" && r.source.needsChannel() {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), sc.timeout)
+			defer cancel()
+			cnr, err := r.read(ctx, tuner, channel)
+			results <- result{tuner.Name, channel.Channel, cnr, err}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		if res.err != nil {
+			logError("signal", fmt.Errorf("%s: %w", res.tuner, res.err))
+			ch <- prometheus.MustNewConstMetric(sc.up, prometheus.GaugeValue, 0, api.Host, res.tuner)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(sc.up, prometheus.GaugeValue, 1, api.Host, res.tuner)
+		ch <- prometheus.MustNewConstMetric(sc.cnr, prometheus.GaugeValue, res.cnr, api.Host, res.tuner, res.channel)
+	}
+}
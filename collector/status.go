@@ -1,9 +1,11 @@
 package collector
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"log/slog"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -87,7 +89,20 @@ type Status struct {
 	} `json:"timerAccuracy"`
 }
 
+func fetchStatus(ctx context.Context, api *ApiInfo) (*Status, error) {
+	body, err := fetchBody(ctx, api, "status", &Query{})
+	if err != nil {
+		return nil, err
+	}
+	var status Status
+	if err := unmarshalTolerant("status", body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
 type statusCollector struct {
+	up                             *prometheus.Desc
 	time                           *prometheus.Desc
 	version                        *prometheus.Desc
 	processArch                    *prometheus.Desc
@@ -141,289 +156,391 @@ type statusCollector struct {
 	timerAccuracyM15Avg            *prometheus.Desc
 	timerAccuracyM15Min            *prometheus.Desc
 	timerAccuracyM15Max            *prometheus.Desc
+	processHeapUtilization         *prometheus.Desc
+	processNonHeapMemory           *prometheus.Desc
+	processRssGrowthRate           *prometheus.Desc
+	hostMemoryTotal                *prometheus.Desc
+	hostMemoryAvailable            *prometheus.Desc
+	processRssHostRatio            *prometheus.Desc
+	processStartTime               *prometheus.Desc
+	processRestarts                *prometheus.Desc
+	eventsStreamConnected          *prometheus.Desc
+	eventsStreamDisconnects        *prometheus.Desc
+	clockOffset                    *prometheus.Desc
+	clockRoundTrip                 *prometheus.Desc
+
+	rssWindow   *rssWindow
+	meminfoPath string
+	restarts    restartTracker
+	events      *eventsWatcher
+	target      targetRoot
 }
 
 func NewStatusCollector() *statusCollector {
+	// Host memory is only meaningful when the exporter runs next to Mirakurun
+	meminfoPath, _ := os.LookupEnv("MIRAKURUN_HOST_MEMINFO")
+
+	var events *eventsWatcher
+	if lookupEnvBool("MIRAKURUN_EVENTS_STREAM") {
+		events = &eventsWatcher{}
+	}
+
 	return &statusCollector{
-		time: prometheus.NewDesc(
+		rssWindow:   newRSSWindow(LookupEnvDuration("MIRAKURUN_RSS_GROWTH_WINDOW", 15*time.Minute)),
+		meminfoPath: meminfoPath,
+		events:      events,
+
+		up: newDesc(
+			"mirakurun_up",
+			"Whether /api/status could be fetched.",
+			[]string{"host"},
+			nil),
+		time: newDesc(
 			"mirakurun_status_time",
 			"mirakurun Status Time",
 			[]string{"host"},
 			nil),
-		version: prometheus.NewDesc(
+		version: newDesc(
 			"mirakurun_status_version",
 			"mirakurun Status Version",
 			[]string{"host", "version"},
 			nil),
 
 		// Process
-		processArch: prometheus.NewDesc(
+		processArch: newDesc(
 			"mirakurun_status_process_arch",
 			"mirakurun Status Process Arch",
 			[]string{"host"},
 			nil),
-		processPlatform: prometheus.NewDesc(
+		processPlatform: newDesc(
 			"mirakurun_status_process_platform",
 			"mirakurun Status Process Platform",
 			[]string{"host"},
 			nil),
-		processVersionsNode: prometheus.NewDesc(
+		processVersionsNode: newDesc(
 			"mirakurun_status_process_versions_node",
 			"mirakurun node version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsV8: prometheus.NewDesc(
+		processVersionsV8: newDesc(
 			"mirakurun_status_process_versions_v8",
 			"mirakurun v8 version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsUv: prometheus.NewDesc(
+		processVersionsUv: newDesc(
 			"mirakurun_status_process_versions_uv",
 			"mirakurun uv version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsZlib: prometheus.NewDesc(
+		processVersionsZlib: newDesc(
 			"mirakurun_status_process_versions_zlib",
 			"mirakurun zlib version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsBrotli: prometheus.NewDesc(
+		processVersionsBrotli: newDesc(
 			"mirakurun_status_process_versions_brotli",
 			"mirakurun brotli version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsAres: prometheus.NewDesc(
+		processVersionsAres: newDesc(
 			"mirakurun_status_process_versions_ares",
 			"mirakurun Ares version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsModules: prometheus.NewDesc(
+		processVersionsModules: newDesc(
 			"mirakurun_status_process_versions_modules",
 			"mirakurun modules version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsNghttp2: prometheus.NewDesc(
+		processVersionsNghttp2: newDesc(
 			"mirakurun_status_process_versions_nghttp2",
 			"mirakurun nghttp2 version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsNapi: prometheus.NewDesc(
+		processVersionsNapi: newDesc(
 			"mirakurun_status_process_versions_napi",
 			"mirakurun napi version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsLlhttp: prometheus.NewDesc(
+		processVersionsLlhttp: newDesc(
 			"mirakurun_status_process_versions_llhttp",
 			"mirakurun llhttp version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsOpenssl: prometheus.NewDesc(
+		processVersionsOpenssl: newDesc(
 			"mirakurun_status_process_versions_openssl",
 			"mirakurun openssl version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsCldr: prometheus.NewDesc(
+		processVersionsCldr: newDesc(
 			"mirakurun_status_process_versions_cldr",
 			"mirakurun cldr version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsIcu: prometheus.NewDesc(
+		processVersionsIcu: newDesc(
 			"mirakurun_status_process_versions_icu",
 			"mirakurun icu version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsTz: prometheus.NewDesc(
+		processVersionsTz: newDesc(
 			"mirakurun_status_process_versions_tz",
 			"mirakurun tz version",
 			[]string{"host", "version"},
 			nil),
-		processVersionsUnicode: prometheus.NewDesc(
+		processVersionsUnicode: newDesc(
 			"mirakurun_status_process_versions_unicode",
 			"mirakurun unicode version",
 			[]string{"host", "version"},
 			nil),
-		processEnvPath: prometheus.NewDesc(
+		processEnvPath: newDesc(
 			"mirakurun_status_process_env_path",
 			"mirakurun Status Process Env Path",
 			[]string{"host", "path"},
 			nil),
-		processEnvUsingWinser: prometheus.NewDesc(
+		processEnvUsingWinser: newDesc(
 			"mirakurun_status_process_env_usingwinser",
 			"mirakurun Status Process Env UsingWinser",
 			[]string{"host"},
 			nil),
-		processEnvNodeEnv: prometheus.NewDesc(
+		processEnvNodeEnv: newDesc(
 			"mirakurun_status_process_env_nodeenv",
 			"mirakurun Status Process Env NodeEnv",
 			[]string{"host", "node_env"},
 			nil),
-		processEnvTunersConfigPath: prometheus.NewDesc(
+		processEnvTunersConfigPath: newDesc(
 			"mirakurun_status_process_env_tunersconfigpath",
 			"mirakurun Status Process Env TunersConfigPath",
 			[]string{"host", "tuners_config_path"},
 			nil),
-		processEnvServerConfigPath: prometheus.NewDesc(
+		processEnvServerConfigPath: newDesc(
 			"mirakurun_status_process_env_serverconfigpath",
 			"mirakurun Status Process Env ServerConfigPath",
 			[]string{"host", "server_config_path"},
 			nil),
-		processEnvChannelsConfigPath: prometheus.NewDesc(
+		processEnvChannelsConfigPath: newDesc(
 			"mirakurun_status_process_env_channelsconfigpath",
 			"mirakurun Status Process Env ChannelsConfigPath",
 			[]string{"host", "channels_config_path"},
 			nil),
-		processEnvServicesDbPath: prometheus.NewDesc(
+		processEnvServicesDbPath: newDesc(
 			"mirakurun_status_process_env_servicesdbpath",
 			"mirakurun Status Process Env ServicesDbPath",
 			[]string{"host", "services_db_path"},
 			nil),
-		processEnvProgramsDbPath: prometheus.NewDesc(
+		processEnvProgramsDbPath: newDesc(
 			"mirakurun_status_process_env_programsdbpath",
 			"mirakurun Status Process Env ProgramsDbPath",
 			[]string{"host", "programs_db_path"},
 			nil),
-		processPid: prometheus.NewDesc(
+		processPid: newDesc(
 			"mirakurun_status_process_pid",
 			"mirakurun Status Process Pid",
 			[]string{"host"},
 			nil),
-		processMemoryUsageRss: prometheus.NewDesc(
+		processMemoryUsageRss: newDesc(
 			"mirakurun_status_process_memoryusage_rss",
 			"mirakurun Status Process MemoryUsage Rss",
 			[]string{"host"},
 			nil),
-		processMemoryUsageHeapTotal: prometheus.NewDesc(
+		processMemoryUsageHeapTotal: newDesc(
 			"mirakurun_status_process_memoryusage_heaptotal",
 			"mirakurun Status Process MemoryUsage HeapTotal",
 			[]string{"host"},
 			nil),
-		processMemoryUsageHeapUsed: prometheus.NewDesc(
+		processMemoryUsageHeapUsed: newDesc(
 			"mirakurun_status_process_memoryusage_heapused",
 			"mirakurun Status Process MemoryUsage HeapUsed",
 			[]string{"host"},
 			nil),
-		processMemoryUsageExternal: prometheus.NewDesc(
+		processMemoryUsageExternal: newDesc(
 			"mirakurun_status_process_memoryusage_external",
 			"mirakurun Status Process MemoryUsage External",
 			[]string{"host"},
 			nil),
-		processMemoryUsageArrayBuffers: prometheus.NewDesc(
+		processMemoryUsageArrayBuffers: newDesc(
 			"mirakurun_status_process_memoryusage_arraybuffers",
 			"mirakurun Status Process MemoryUsage ArrayBuffers",
 			[]string{"host"},
 			nil),
 
 		// Epg
-		epgGatheringNetworks: prometheus.NewDesc(
+		epgGatheringNetworks: newDesc(
 			"mirakurun_status_epg_gatheringnetworks",
 			"mirakurun Status Epg GatheringNetworks",
 			[]string{"host"},
 			nil),
-		epgStoredEvents: prometheus.NewDesc(
+		epgStoredEvents: newDesc(
 			"mirakurun_status_epg_storedevents",
 			"mirakurun Status Epg StoredEvents",
 			[]string{"host"},
 			nil),
 
 		// StreamCount
-		streamCountTunerDevice: prometheus.NewDesc(
+		streamCountTunerDevice: newDesc(
 			"mirakurun_status_streamcount_tunerdevice",
 			"mirakurun Status StreamCount TunerDevice",
 			[]string{"host"},
 			nil),
-		streamCountTsFilter: prometheus.NewDesc(
+		streamCountTsFilter: newDesc(
 			"mirakurun_status_streamcount_tsfilter",
 			"mirakurun Status StreamCount TsFilter",
 			[]string{"host"},
 			nil),
-		streamCountDecoder: prometheus.NewDesc(
+		streamCountDecoder: newDesc(
 			"mirakurun_status_streamcount_decoder",
 			"mirakurun Status StreamCount Decoder",
 			[]string{"host"},
 			nil),
 
 		// ErrorCount
-		errorCountUncaughtException: prometheus.NewDesc(
+		errorCountUncaughtException: newDesc(
 			"mirakurun_status_errorcount_uncaughtexception",
 			"mirakurun Status ErrorCount UncaughtException",
 			[]string{"host"},
 			nil),
-		errorCountUnhandledRejection: prometheus.NewDesc(
+		errorCountUnhandledRejection: newDesc(
 			"mirakurun_status_errorcount_unhandledrejection",
 			"mirakurun Status ErrorCount UnhandledRejection",
 			[]string{"host"},
 			nil),
-		errorCountBufferOverflow: prometheus.NewDesc(
+		errorCountBufferOverflow: newDesc(
 			"mirakurun_status_errorcount_bufferoverflow",
 			"mirakurun Status ErrorCount BufferOverflow",
 			[]string{"host"},
 			nil),
-		errorCountTunerDeviceRespawn: prometheus.NewDesc(
+		errorCountTunerDeviceRespawn: newDesc(
 			"mirakurun_status_errorcount_tunerdevicerespawn",
 			"mirakurun Status ErrorCount TunerDeviceRespawn",
 			[]string{"host"},
 			nil),
-		errorCountDecoderRespawn: prometheus.NewDesc(
+		errorCountDecoderRespawn: newDesc(
 			"mirakurun_status_errorcount_decoderrespawn",
 			"mirakurun Status ErrorCount DecoderRespawn",
 			[]string{"host"},
 			nil),
 
 		// TimerAccuracy
-		timerAccuracyLast: prometheus.NewDesc(
+		timerAccuracyLast: newDesc(
 			"mirakurun_status_timeraccuracy_last",
 			"mirakurun Status TimerAccuracy Last",
 			[]string{"host"},
 			nil),
-		timerAccuracyM1Avg: prometheus.NewDesc(
+		timerAccuracyM1Avg: newDesc(
 			"mirakurun_status_timeraccuracy_m1_avg",
 			"mirakurun Status TimerAccuracy M1 Avg",
 			[]string{"host"},
 			nil),
-		timerAccuracyM1Min: prometheus.NewDesc(
+		timerAccuracyM1Min: newDesc(
 			"mirakurun_status_timeraccuracy_m1_min",
 			"mirakurun Status TimerAccuracy M1 Min",
 			[]string{"host"},
 			nil),
-		timerAccuracyM1Max: prometheus.NewDesc(
+		timerAccuracyM1Max: newDesc(
 			"mirakurun_status_timeraccuracy_m1_max",
 			"mirakurun Status TimerAccuracy M1 Max",
 			[]string{"host"},
 			nil),
-		timerAccuracyM5Avg: prometheus.NewDesc(
+		timerAccuracyM5Avg: newDesc(
 			"mirakurun_status_timeraccuracy_m5_avg",
 			"mirakurun Status TimerAccuracy M5 Avg",
 			[]string{"host"},
 			nil),
-		timerAccuracyM5Min: prometheus.NewDesc(
+		timerAccuracyM5Min: newDesc(
 			"mirakurun_status_timeraccuracy_m5_min",
 			"mirakurun Status TimerAccuracy M5 Min",
 			[]string{"host"},
 			nil),
-		timerAccuracyM5Max: prometheus.NewDesc(
+		timerAccuracyM5Max: newDesc(
 			"mirakurun_status_timeraccuracy_m5_max",
 			"mirakurun Status TimerAccuracy M5 Max",
 			[]string{"host"},
 			nil),
-		timerAccuracyM15Avg: prometheus.NewDesc(
+		timerAccuracyM15Avg: newDesc(
 			"mirakurun_status_timeraccuracy_m15_avg",
 			"mirakurun Status TimerAccuracy M15 avg",
 			[]string{"host"},
 			nil),
-		timerAccuracyM15Min: prometheus.NewDesc(
+		timerAccuracyM15Min: newDesc(
 			"mirakurun_status_timeraccuracy_m15_min",
 			"mirakurun Status TimerAccuracy M15 Min",
 			[]string{"host"},
 			nil),
-		timerAccuracyM15Max: prometheus.NewDesc(
+		timerAccuracyM15Max: newDesc(
 			"mirakurun_status_timeraccuracy_m15_max",
 			"mirakurun Status TimerAccuracy M15 Max",
 			[]string{"host"},
 			nil),
+
+		// Memory pressure
+		processHeapUtilization: newDesc(
+			"mirakurun_process_heap_utilization_ratio",
+			"Ratio of heapUsed to heapTotal of the mirakurun process.",
+			[]string{"host"},
+			nil),
+		processNonHeapMemory: newDesc(
+			"mirakurun_process_nonheap_memory_bytes",
+			"RSS minus heapTotal of the mirakurun process.",
+			[]string{"host"},
+			nil),
+		processRssGrowthRate: newDesc(
+			"mirakurun_process_rss_growth_bytes_per_second",
+			"Growth rate of the mirakurun RSS over the exporter's sliding window.",
+			[]string{"host"},
+			nil),
+		hostMemoryTotal: newDesc(
+			"mirakurun_host_memory_total_bytes",
+			"MemTotal of the host the exporter runs on.",
+			[]string{"host"},
+			nil),
+		hostMemoryAvailable: newDesc(
+			"mirakurun_host_memory_available_bytes",
+			"MemAvailable of the host the exporter runs on.",
+			[]string{"host"},
+			nil),
+		processRssHostRatio: newDesc(
+			"mirakurun_process_rss_host_memory_ratio",
+			"Ratio of the mirakurun RSS to MemTotal of the host.",
+			[]string{"host"},
+			nil),
+
+		// Restart detection
+		processStartTime: newDesc(
+			"mirakurun_process_start_time_seconds",
+			"Mirakurun time at which the exporter first saw the current mirakurun process.",
+			[]string{"host"},
+			nil),
+		processRestarts: newDesc(
+			"mirakurun_process_restarts_total",
+			"Number of mirakurun restarts detected by a PID change or an error counter reset.",
+			[]string{"host"},
+			nil),
+		eventsStreamConnected: newDesc(
+			"mirakurun_events_stream_connected",
+			"Whether the exporter is connected to /api/events/stream.",
+			[]string{"host"},
+			nil),
+		eventsStreamDisconnects: newDesc(
+			"mirakurun_events_stream_disconnects_total",
+			"Number of times /api/events/stream was closed after being connected.",
+			[]string{"host"},
+			nil),
+
+		// Clock
+		clockOffset: newDesc(
+			"mirakurun_clock_offset_seconds",
+			"Offset of the mirakurun clock from the exporter clock, corrected for the request round trip.",
+			[]string{"host"},
+			nil),
+		clockRoundTrip: newDesc(
+			"mirakurun_clock_round_trip_seconds",
+			"Round trip time of the /api/status request used for the clock offset.",
+			[]string{"host"},
+			nil),
 	}
 }
 
 func (sc *statusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.up
 	ch <- sc.time
 	ch <- sc.version
 	ch <- sc.processArch
@@ -477,16 +594,86 @@ func (sc *statusCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- sc.timerAccuracyM15Avg
 	ch <- sc.timerAccuracyM15Min
 	ch <- sc.timerAccuracyM15Max
+	ch <- sc.processHeapUtilization
+	ch <- sc.processNonHeapMemory
+	ch <- sc.processRssGrowthRate
+	if sc.meminfoPath != "" {
+		ch <- sc.hostMemoryTotal
+		ch <- sc.hostMemoryAvailable
+		ch <- sc.processRssHostRatio
+	}
+	ch <- sc.processStartTime
+	ch <- sc.processRestarts
+	if sc.events != nil {
+		ch <- sc.eventsStreamConnected
+		ch <- sc.eventsStreamDisconnects
+	}
+	ch <- sc.clockOffset
+	ch <- sc.clockRoundTrip
+}
+
+// Run watches /api/events/stream until ctx is done when MIRAKURUN_EVENTS_STREAM
+// is enabled, and returns immediately otherwise.
+func (sc *statusCollector) Run(ctx context.Context) {
+	if sc.events == nil {
+		return
+	}
+	sc.events.run(ctx, func(ctx context.Context) error {
+		api := newAPI()
+		status, err := fetchStatus(ctx, &api)
+		if err != nil {
+			return err
+		}
+		if hasProcess(ctx, &api, status) {
+			sc.observe(&api, status)
+		}
+		return nil
+	})
+}
+
+// hasProcess reports whether status has the process information mirakc
+// leaves out of /api/status. When the server cannot be detected, status
+// itself is trusted so that /api/version failing does not hide it.
+func hasProcess(ctx context.Context, api *ApiInfo, status *Status) bool {
+	mirakc, err := isMirakc(ctx, api)
+	if err != nil {
+		return status.Process.Pid != 0
+	}
+	return !mirakc
+}
+
+func (sc *statusCollector) observe(api *ApiInfo, status *Status) {
+	// 別の Mirakurun に切り替わったら前のプロセスの状態は捨てる
+	if sc.target.changed(api) {
+		slog.Info("mirakurun target changed", "url", getApiRoot(api))
+		sc.restarts.reset()
+		sc.rssWindow.reset()
+	}
+	if sc.restarts.observe(status) {
+		slog.Info("mirakurun restarted", "pid", status.Process.Pid)
+		sc.rssWindow.reset()
+	}
 }
 
 func (sc *statusCollector) Collect(ch chan<- prometheus.Metric) {
 	api := newAPI()
-	body := fetch(&api, "status", &Query{})
+	sent := time.Now()
+	status, err := fetchStatus(context.Background(), &api)
+	received := time.Now()
+	if err != nil {
+		logError("status", err)
+		ch <- prometheus.MustNewConstMetric(sc.up, prometheus.GaugeValue, 0, api.Host)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(sc.up, prometheus.GaugeValue, 1, api.Host)
+	if status.Time != 0 {
+		sc.collectClock(ch, &api, status, sent, received)
+	}
 
-	var status Status
-	if err := json.Unmarshal(body, &status); err != nil {
-		log.Fatal(err)
+	if !hasProcess(context.Background(), &api, status) {
+		return
 	}
+	sc.observe(&api, status)
 
 	usingWinser, _ := strconv.ParseFloat(status.Process.Env.UsingWinser, 64)
 
@@ -787,4 +974,107 @@ func (sc *statusCollector) Collect(ch chan<- prometheus.Metric) {
 		prometheus.GaugeValue,
 		status.TimerAccuracy.M15.Max,
 		api.Host)
+
+	sc.collectMemoryPressure(ch, &api, status)
+	sc.collectRestarts(ch, &api)
+}
+
+func (sc *statusCollector) collectMemoryPressure(ch chan<- prometheus.Metric, api *ApiInfo, status *Status) {
+	mem := status.Process.MemoryUsage
+	rss := float64(mem.Rss)
+
+	if mem.HeapTotal > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			sc.processHeapUtilization,
+			prometheus.GaugeValue,
+			float64(mem.HeapUsed)/float64(mem.HeapTotal),
+			api.Host)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		sc.processNonHeapMemory,
+		prometheus.GaugeValue,
+		float64(mem.Rss-mem.HeapTotal),
+		api.Host)
+	if rate, ok := sc.rssWindow.observe(time.Now(), rss); ok {
+		ch <- prometheus.MustNewConstMetric(
+			sc.processRssGrowthRate,
+			prometheus.GaugeValue,
+			rate,
+			api.Host)
+	}
+
+	if sc.meminfoPath == "" {
+		return
+	}
+	host, err := readMeminfo(sc.meminfoPath)
+	if err != nil {
+		logError("status", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		sc.hostMemoryTotal,
+		prometheus.GaugeValue,
+		host.Total,
+		api.Host)
+	ch <- prometheus.MustNewConstMetric(
+		sc.hostMemoryAvailable,
+		prometheus.GaugeValue,
+		host.Available,
+		api.Host)
+	if host.Total > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			sc.processRssHostRatio,
+			prometheus.GaugeValue,
+			rss/host.Total,
+			api.Host)
+	}
+}
+
+func (sc *statusCollector) collectRestarts(ch chan<- prometheus.Metric, api *ApiInfo) {
+	if startTime, restarts, ok := sc.restarts.values(); ok {
+		ch <- prometheus.MustNewConstMetric(
+			sc.processStartTime,
+			prometheus.GaugeValue,
+			startTime,
+			api.Host)
+		ch <- prometheus.MustNewConstMetric(
+			sc.processRestarts,
+			prometheus.CounterValue,
+			restarts,
+			api.Host)
+	}
+
+	if sc.events == nil {
+		return
+	}
+	connected, disconnects := sc.events.values()
+	ch <- prometheus.MustNewConstMetric(
+		sc.eventsStreamConnected,
+		prometheus.GaugeValue,
+		connected,
+		api.Host)
+	ch <- prometheus.MustNewConstMetric(
+		sc.eventsStreamDisconnects,
+		prometheus.CounterValue,
+		disconnects,
+		api.Host)
+}
+
+// collectClock assumes Mirakurun stamped status.Time halfway through the
+// request, like NTP does.
+func (sc *statusCollector) collectClock(ch chan<- prometheus.Metric, api *ApiInfo, status *Status, sent, received time.Time) {
+	roundTrip := received.Sub(sent)
+	local := sent.Add(roundTrip / 2)
+	remote := time.Unix(0, status.Time*int64(time.Millisecond))
+
+	ch <- prometheus.MustNewConstMetric(
+		sc.clockOffset,
+		prometheus.GaugeValue,
+		remote.Sub(local).Seconds(),
+		api.Host)
+	ch <- prometheus.MustNewConstMetric(
+		sc.clockRoundTrip,
+		prometheus.GaugeValue,
+		roundTrip.Seconds(),
+		api.Host)
 }
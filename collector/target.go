@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// targetConfig is the JSON file named by MIRAKURUN_CONFIG. The keys are the
+// prefixes of the environment variables in lower case.
+//
+//	{
+//	  "mirakurun": { "host": "tuner.local", "port": "40772" },
+//	  "epgstation": { "host": "recorder.local" }
+//	}
+type targetConfig map[string]ApiInfo
+
+var targetConfigs = struct {
+	sync.RWMutex
+	config targetConfig
+	// 読み込むたびに閉じて作り直す
+	reloaded chan struct{}
+}{reloaded: make(chan struct{})}
+
+// LoadConfig reads the target configuration file named by MIRAKURUN_CONFIG.
+// It does nothing when it is not set, and keeps the current configuration
+// when the file cannot be read.
+func LoadConfig() error {
+	path, ok := os.LookupEnv("MIRAKURUN_CONFIG")
+	if !ok {
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config targetConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return err
+	}
+
+	targetConfigs.Lock()
+	targetConfigs.config = config
+	close(targetConfigs.reloaded)
+	targetConfigs.reloaded = make(chan struct{})
+	targetConfigs.Unlock()
+	return nil
+}
+
+// waitTargetChange blocks until a reload points the Mirakurun target away
+// from api, and reports false if ctx is done first.
+func waitTargetChange(ctx context.Context, api ApiInfo) bool {
+	for {
+		targetConfigs.RLock()
+		reloaded := targetConfigs.reloaded
+		targetConfigs.RUnlock()
+		if newAPI() != api {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-reloaded:
+		}
+	}
+}
+
+// targetRoot remembers which Mirakurun the state of a collector belongs to.
+type targetRoot struct {
+	mu   sync.Mutex
+	root string
+}
+
+// changed records the API root of api and reports whether it differs from
+// the one recorded before. The first call reports false.
+func (t *targetRoot) changed(api *ApiInfo) bool {
+	root := getApiRoot(api)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	changed := t.root != "" && t.root != root
+	t.root = root
+	return changed
+}
+
+func configuredAPI(prefix string) ApiInfo {
+	targetConfigs.RLock()
+	defer targetConfigs.RUnlock()
+	return targetConfigs.config[strings.ToLower(prefix)]
+}
+
+// configured reports whether the host of an optional target is set either in
+// the environment or in the target configuration file.
+func configured(prefix string) bool {
+	if _, ok := os.LookupEnv(prefix + "_HOST"); ok {
+		return true
+	}
+	return configuredAPI(prefix).Host != ""
+}
+
+// Target is an upstream server the exporter reads from.
+type Target struct {
+	Name string
+	URL  string
+}
+
+// Targets returns the configured upstream servers.
+func Targets() []Target {
+	api := newAPI()
+	targets := []Target{{Name: "mirakurun", URL: getApiRoot(&api)}}
+	for _, t := range []struct{ name, prefix, port string }{
+		{"epgstation", "EPGSTATION", "8888"},
+		{"chinachu", "CHINACHU", "20772"},
+	} {
+		if configured(t.prefix) {
+			api := lookupAPI(t.prefix, t.port)
+			targets = append(targets, Target{Name: t.name, URL: getApiRoot(&api)})
+		}
+	}
+	return targets
+}
@@ -0,0 +1,186 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// JSON展開用
+type TimeshiftRecorder struct {
+	Name    string `json:"name"`
+	Service struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"service"`
+	StartTime int64 `json:"startTime"`
+	Duration  int64 `json:"duration"`
+	Pipeline  []struct {
+		Command string `json:"command"`
+		Pid     *int   `json:"pid"`
+	} `json:"pipeline"`
+	Recording bool `json:"recording"`
+}
+
+// JSON展開用
+type TimeshiftRecord struct {
+	ID        int64   `json:"id"`
+	StartTime int64   `json:"startTime"`
+	Duration  int64   `json:"duration"`
+	Size      float64 `json:"size"`
+}
+
+// timeshiftCollector exports the timeshift recorders of mirakc. Mirakurun
+// has no /api/timeshift, so nothing is exported for it.
+type timeshiftCollector struct {
+	info            *prometheus.Desc
+	recording       *prometheus.Desc
+	startTime       *prometheus.Desc
+	duration        *prometheus.Desc
+	pipeline        *prometheus.Desc
+	records         *prometheus.Desc
+	recordsDuration *prometheus.Desc
+	recordsSize     *prometheus.Desc
+	oldestRecord    *prometheus.Desc
+	newestRecord    *prometheus.Desc
+}
+
+func NewTimeshiftCollector() *timeshiftCollector {
+	return &timeshiftCollector{
+		info: newDesc(
+			"mirakurun_timeshift_recorder_info",
+			"Service recorded by the mirakc timeshift recorder.",
+			[]string{"host", "recorder", "service_id", "service_name"},
+			nil),
+		recording: newDesc(
+			"mirakurun_timeshift_recording",
+			"Whether the mirakc timeshift recorder is recording.",
+			[]string{"host", "recorder"},
+			nil),
+		startTime: newDesc(
+			"mirakurun_timeshift_start_time_seconds",
+			"Start of the timeshift buffer of the mirakc timeshift recorder.",
+			[]string{"host", "recorder"},
+			nil),
+		duration: newDesc(
+			"mirakurun_timeshift_duration_seconds",
+			"Length of the timeshift buffer of the mirakc timeshift recorder.",
+			[]string{"host", "recorder"},
+			nil),
+		pipeline: newDesc(
+			"mirakurun_timeshift_pipeline_processes",
+			"Number of processes in the pipeline of the mirakc timeshift recorder by state.",
+			[]string{"host", "recorder", "state"},
+			nil),
+		records: newDesc(
+			"mirakurun_timeshift_records",
+			"Number of records of the mirakc timeshift recorder.",
+			[]string{"host", "recorder"},
+			nil),
+		recordsDuration: newDesc(
+			"mirakurun_timeshift_records_duration_seconds",
+			"Total duration of the records of the mirakc timeshift recorder.",
+			[]string{"host", "recorder"},
+			nil),
+		recordsSize: newDesc(
+			"mirakurun_timeshift_records_size_bytes",
+			"Total size of the records of the mirakc timeshift recorder.",
+			[]string{"host", "recorder"},
+			nil),
+		oldestRecord: newDesc(
+			"mirakurun_timeshift_oldest_record_start_timestamp_seconds",
+			"Start of the oldest record of the mirakc timeshift recorder.",
+			[]string{"host", "recorder"},
+			nil),
+		newestRecord: newDesc(
+			"mirakurun_timeshift_newest_record_end_timestamp_seconds",
+			"End of the newest record of the mirakc timeshift recorder.",
+			[]string{"host", "recorder"},
+			nil),
+	}
+}
+
+func (tc *timeshiftCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tc.info
+	ch <- tc.recording
+	ch <- tc.startTime
+	ch <- tc.duration
+	ch <- tc.pipeline
+	ch <- tc.records
+	ch <- tc.recordsDuration
+	ch <- tc.recordsSize
+	ch <- tc.oldestRecord
+	ch <- tc.newestRecord
+}
+
+func (tc *timeshiftCollector) Collect(ch chan<- prometheus.Metric) {
+	api := newAPI()
+	ctx := context.Background()
+	mirakc, err := isMirakc(ctx, &api)
+	if err != nil {
+		logError("timeshift", err)
+		return
+	}
+	if !mirakc {
+		return
+	}
+
+	var recorders []TimeshiftRecorder
+	if err := fetchJSON(ctx, &api, "timeshift", &Query{}, &recorders); err != nil {
+		logError("timeshift", err)
+		return
+	}
+
+	for _, r := range recorders {
+		ch <- prometheus.MustNewConstMetric(tc.info, prometheus.GaugeValue, 1, api.Host, r.Name, strconv.FormatInt(r.Service.ID, 10), r.Service.Name)
+		ch <- prometheus.MustNewConstMetric(tc.recording, prometheus.GaugeValue, boolToFloat(r.Recording), api.Host, r.Name)
+		ch <- prometheus.MustNewConstMetric(tc.startTime, prometheus.GaugeValue, float64(r.StartTime)/1000, api.Host, r.Name)
+		ch <- prometheus.MustNewConstMetric(tc.duration, prometheus.GaugeValue, float64(r.Duration)/1000, api.Host, r.Name)
+
+		// pidがないプロセスは終了している
+		var running, stopped float64
+		for _, p := range r.Pipeline {
+			if p.Pid != nil {
+				running++
+			} else {
+				stopped++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(tc.pipeline, prometheus.GaugeValue, running, api.Host, r.Name, "running")
+		ch <- prometheus.MustNewConstMetric(tc.pipeline, prometheus.GaugeValue, stopped, api.Host, r.Name, "stopped")
+
+		tc.collectRecords(ch, &api, r.Name)
+	}
+}
+
+func (tc *timeshiftCollector) collectRecords(ch chan<- prometheus.Metric, api *ApiInfo, recorder string) {
+	var records []TimeshiftRecord
+	namespace := fmt.Sprintf("timeshift/%s/records", url.PathEscape(recorder))
+	if err := fetchJSON(context.Background(), api, namespace, &Query{}, &records); err != nil {
+		logError("timeshift", err)
+		return
+	}
+
+	var duration, size float64
+	var oldest, newest int64
+	for i, r := range records {
+		duration += float64(r.Duration) / 1000
+		size += r.Size
+		if i == 0 || r.StartTime < oldest {
+			oldest = r.StartTime
+		}
+		if end := r.StartTime + r.Duration; end > newest {
+			newest = end
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(tc.records, prometheus.GaugeValue, float64(len(records)), api.Host, recorder)
+	ch <- prometheus.MustNewConstMetric(tc.recordsDuration, prometheus.GaugeValue, duration, api.Host, recorder)
+	ch <- prometheus.MustNewConstMetric(tc.recordsSize, prometheus.GaugeValue, size, api.Host, recorder)
+	if len(records) > 0 {
+		ch <- prometheus.MustNewConstMetric(tc.oldestRecord, prometheus.GaugeValue, float64(oldest)/1000, api.Host, recorder)
+		ch <- prometheus.MustNewConstMetric(tc.newestRecord, prometheus.GaugeValue, float64(newest)/1000, api.Host, recorder)
+	}
+}
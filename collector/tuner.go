@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type tunerCollector struct {
+	available *prometheus.Desc
+	fault     *prometheus.Desc
+	users     *prometheus.Desc
+}
+
+func NewTunerCollector() *tunerCollector {
+	labels := []string{"host", "index", "tuner"}
+	return &tunerCollector{
+		available: newDesc(
+			"mirakurun_tuner_available",
+			"Whether the tuner is available.",
+			labels,
+			nil),
+		fault: newDesc(
+			"mirakurun_tuner_fault",
+			"Whether the tuner is in fault state.",
+			labels,
+			nil),
+		users: newDesc(
+			"mirakurun_tuner_users",
+			"Number of users of the tuner.",
+			labels,
+			nil),
+	}
+}
+
+func (tc *tunerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tc.available
+	ch <- tc.fault
+	ch <- tc.users
+}
+
+func (tc *tunerCollector) Collect(ch chan<- prometheus.Metric) {
+	api := newAPI()
+	var tuners []Tuner
+	if err := fetchJSON(context.Background(), &api, "tuners", &Query{}, &tuners); err != nil {
+		logError("tuner", err)
+		return
+	}
+
+	for _, t := range tuners {
+		index := strconv.Itoa(t.Index)
+		ch <- prometheus.MustNewConstMetric(tc.available, prometheus.GaugeValue, boolToFloat(t.IsAvailable), api.Host, index, t.Name)
+		ch <- prometheus.MustNewConstMetric(tc.fault, prometheus.GaugeValue, boolToFloat(t.IsFault), api.Host, index, t.Name)
+		ch <- prometheus.MustNewConstMetric(tc.users, prometheus.GaugeValue, float64(len(t.Users)), api.Host, index, t.Name)
+	}
+}
@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	upstreamDuration = newHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mirakurun_exporter_upstream_request_duration_seconds",
+			Help:    "Time until the response headers of an upstream API request, by endpoint.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"host", "endpoint", "code"})
+	upstreamSize = newHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mirakurun_exporter_upstream_response_size_bytes",
+			Help:    "Size of the upstream API responses read by the exporter, by endpoint.",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+		},
+		[]string{"host", "endpoint"})
+)
+
+// lastPoll is when Mirakurun last answered a request successfully.
+var lastPoll pollTime
+
+type pollTime struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (p *pollTime) set(t time.Time) {
+	p.mu.Lock()
+	p.t = t
+	p.mu.Unlock()
+}
+
+func (p *pollTime) get() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.t
+}
+
+// LastPoll returns when Mirakurun last answered a request successfully.
+func LastPoll() time.Time {
+	return lastPoll.get()
+}
+
+// Ping polls the lightweight /api/version of Mirakurun.
+func Ping(ctx context.Context) error {
+	api := newAPI()
+	_, err := fetchBody(ctx, &api, "version", &Query{})
+	return err
+}
+
+type upstreamCollector struct{}
+
+// NewUpstreamCollector returns the collector of the latency and size of the
+// requests the exporter makes.
+func NewUpstreamCollector() *upstreamCollector {
+	return &upstreamCollector{}
+}
+
+func (uc *upstreamCollector) Describe(ch chan<- *prometheus.Desc) {
+	upstreamDuration.Describe(ch)
+	upstreamSize.Describe(ch)
+}
+
+func (uc *upstreamCollector) Collect(ch chan<- prometheus.Metric) {
+	upstreamDuration.Collect(ch)
+	upstreamSize.Collect(ch)
+}
+
+// endpointOf replaces the IDs in namespace so that the endpoint label does
+// not grow with channels and services.
+func endpointOf(namespace string) string {
+	parts := strings.Split(namespace, "/")
+	switch {
+	case parts[0] == "channels" && len(parts) >= 3:
+		parts[1], parts[2] = "{type}", "{channel}"
+	case parts[0] == "services" && len(parts) >= 2:
+		parts[1] = "{id}"
+	case parts[0] == "programs" && len(parts) >= 2:
+		parts[1] = "{id}"
+	}
+	return strings.Join(parts, "/")
+}
+
+// do sends req to the upstream API, recording its latency, and its size and
+// log line once the body is closed.
+func do(req *http.Request, apiInfo *ApiInfo, namespace string) (*http.Response, error) {
+	endpoint := endpointOf(namespace)
+	start := time.Now()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		duration := time.Since(start)
+		upstreamDuration.WithLabelValues(apiInfo.Host, endpoint, "error").Observe(duration.Seconds())
+		slog.Warn("upstream request failed",
+			"host", apiInfo.Host,
+			"endpoint", endpoint,
+			"duration_seconds", duration.Seconds(),
+			"err", err)
+		return nil, err
+	}
+	upstreamDuration.WithLabelValues(apiInfo.Host, endpoint, strconv.Itoa(res.StatusCode)).Observe(time.Since(start).Seconds())
+	if res.StatusCode/100 == 2 && *apiInfo == newAPI() {
+		lastPoll.set(time.Now())
+	}
+
+	res.Body = &upstreamBody{
+		ReadCloser: res.Body,
+		host:       apiInfo.Host,
+		endpoint:   endpoint,
+		code:       res.StatusCode,
+		start:      start,
+	}
+	return res, nil
+}
+
+// upstreamBody counts the bytes read from a response body.
+type upstreamBody struct {
+	io.ReadCloser
+	host     string
+	endpoint string
+	code     int
+	start    time.Time
+	bytes    int
+	closed   bool
+}
+
+func (b *upstreamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += n
+	return n, err
+}
+
+func (b *upstreamBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.closed {
+		return err
+	}
+	b.closed = true
+
+	upstreamSize.WithLabelValues(b.host, b.endpoint).Observe(float64(b.bytes))
+	// Mirakurun に無い mirakc の API などは 404 を返すのが普通
+	level := slog.LevelDebug
+	if b.code/100 != 2 && b.code != http.StatusNotFound {
+		level = slog.LevelWarn
+	}
+	slog.Log(context.Background(), level, "upstream request",
+		"host", b.host,
+		"endpoint", b.endpoint,
+		"code", b.code,
+		"duration_seconds", time.Since(b.start).Seconds(),
+		"bytes", b.bytes)
+	return err
+}
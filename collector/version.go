@@ -1,15 +1,23 @@
 package collector
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+const (
+	serverMirakurun = "mirakurun"
+	serverMirakc    = "mirakc"
+)
+
 type versionCollector struct {
 	currentVersion *prometheus.Desc
 	latestVersion  *prometheus.Desc
+	serverInfo     *prometheus.Desc
 }
 
 // JSON展開用
@@ -18,34 +26,93 @@ type Version struct {
 	Latest  string `json:"latest"`
 }
 
+// serverOf tells mirakc from Mirakurun by the Server header mirakc sends.
+func serverOf(res *http.Response) string {
+	if strings.HasPrefix(strings.ToLower(res.Header.Get("Server")), serverMirakc) {
+		return serverMirakc
+	}
+	return serverMirakurun
+}
+
+// fetchVersion returns /api/version and which server answered it.
+func fetchVersion(ctx context.Context, api *ApiInfo) (*Version, string, error) {
+	res, err := get(ctx, api, "version", &Query{})
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := readBody(res)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var version Version
+	if err := unmarshalTolerant("version", body, &version); err != nil {
+		return nil, "", err
+	}
+	server := serverOf(res)
+	servers.Lock()
+	servers.m[*api] = server
+	servers.Unlock()
+	return &version, server, nil
+}
+
+// servers caches the server detected per target. The version collector
+// refreshes it on every scrape.
+var servers = struct {
+	sync.Mutex
+	m map[ApiInfo]string
+}{m: make(map[ApiInfo]string)}
+
+// isMirakc reports whether api is served by mirakc, asking /api/version only
+// when the server has not been detected yet.
+func isMirakc(ctx context.Context, api *ApiInfo) (bool, error) {
+	servers.Lock()
+	server, ok := servers.m[*api]
+	servers.Unlock()
+	if !ok {
+		var err error
+		if _, server, err = fetchVersion(ctx, api); err != nil {
+			return false, err
+		}
+	}
+	return server == serverMirakc, nil
+}
+
 func NewVersionCollector() *versionCollector {
 	return &versionCollector{
-		currentVersion: prometheus.NewDesc(
+		currentVersion: newDesc(
 			"mirakurun_verison_current_version",
 			"Current Version of mirakurun.",
 			[]string{"host", "version"},
 			nil),
-		latestVersion: prometheus.NewDesc(
+		latestVersion: newDesc(
 			"mirakurun_version_latest_version",
 			"Latest version of mirakurun.",
 			[]string{"host", "version"},
 			nil),
+		serverInfo: newDesc(
+			"mirakurun_server_info",
+			"Which Mirakurun compatible server is running, mirakurun or mirakc.",
+			[]string{"host", "server"},
+			nil),
 	}
 }
 
 func (vc *versionCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- vc.currentVersion
 	ch <- vc.latestVersion
+	ch <- vc.serverInfo
 }
 
 func (vc *versionCollector) Collect(ch chan<- prometheus.Metric) {
 	api := newAPI()
-	body := fetch(&api, "version", &Query{})
-	var version Version
-	if err := json.Unmarshal(body, &version); err != nil {
-		log.Fatal(err)
+	version, server, err := fetchVersion(context.Background(), &api)
+	if err != nil {
+		logError("version", err)
+		return
 	}
 
 	ch <- prometheus.MustNewConstMetric(vc.currentVersion, prometheus.GaugeValue, 1, api.Host, version.Current)
 	ch <- prometheus.MustNewConstMetric(vc.latestVersion, prometheus.GaugeValue, 1, api.Host, version.Latest)
+	ch <- prometheus.MustNewConstMetric(vc.serverInfo, prometheus.GaugeValue, 1, api.Host, server)
 }
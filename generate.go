@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"mirakurun-exporter/collector"
+)
+
+// alertRule is an alerting rule of the generated rules file. metrics lists
+// the metrics expr uses so that a renamed metric is caught by generate.
+type alertRule struct {
+	Alert    string
+	Expr     string
+	For      string
+	Severity string
+	Summary  string
+	metrics  []string
+}
+
+var alertRules = []alertRule{
+	{
+		Alert:    "MirakurunDown",
+		Expr:     `mirakurun_up == 0`,
+		For:      "5m",
+		Severity: "critical",
+		Summary:  "Mirakurun on {{ $labels.host }} is not responding.",
+		metrics:  []string{"mirakurun_up"},
+	},
+	{
+		Alert:    "MirakurunTunerFault",
+		Expr:     `mirakurun_tuner_fault == 1`,
+		For:      "1m",
+		Severity: "critical",
+		Summary:  "Tuner {{ $labels.tuner }} on {{ $labels.host }} is in fault state.",
+		metrics:  []string{"mirakurun_tuner_fault"},
+	},
+	{
+		Alert:    "MirakurunEPGStale",
+		Expr:     `changes(mirakurun_status_epg_storedevents[6h]) == 0 and mirakurun_up == 1`,
+		For:      "30m",
+		Severity: "warning",
+		Summary:  "EPG of Mirakurun on {{ $labels.host }} has not been updated for 6 hours.",
+		metrics:  []string{"mirakurun_status_epg_storedevents", "mirakurun_up"},
+	},
+	{
+		Alert:    "MirakurunBufferOverflow",
+		Expr:     `increase(mirakurun_status_errorcount_bufferoverflow[15m]) > 0`,
+		Severity: "warning",
+		Summary:  "Mirakurun on {{ $labels.host }} is overflowing its stream buffers.",
+		metrics:  []string{"mirakurun_status_errorcount_bufferoverflow"},
+	},
+	{
+		Alert:    "MirakurunUpdateAvailable",
+		Expr:     `mirakurun_version_latest_version unless on(host, version) mirakurun_verison_current_version`,
+		For:      "1h",
+		Severity: "info",
+		Summary:  "Mirakurun {{ $labels.version }} is available on {{ $labels.host }}.",
+		metrics:  []string{"mirakurun_version_latest_version", "mirakurun_verison_current_version"},
+	},
+}
+
+var rulesTemplate = template.Must(template.New("rules").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`groups:
+  - name: mirakurun
+    rules:
+{{- range . }}
+      - alert: {{ .Alert }}
+        expr: {{ quote .Expr }}
+{{- if .For }}
+        for: {{ .For }}
+{{- end }}
+        labels:
+          severity: {{ .Severity }}
+        annotations:
+          summary: {{ quote .Summary }}
+{{- end }}
+`))
+
+// generate runs the generate subcommand, which writes a Prometheus rules
+// file or a Grafana dashboard for the metrics the collectors describe.
+func generate(args []string) int {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mirakurun-exporter generate rules|dashboard")
+	}
+	fs.Parse(args)
+
+	collectors := newCollectors()
+	var err error
+	switch fs.Arg(0) {
+	case "rules":
+		err = writeRules(os.Stdout, collectors)
+	case "dashboard":
+		err = writeDashboard(os.Stdout, collectors)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		slog.Error("generate failed", "err", err)
+		return 1
+	}
+	return 0
+}
+
+func writeRules(w io.Writer, collectors []namedCollector) error {
+	described := make(map[string]bool)
+	for _, c := range collectors {
+		for _, m := range collector.Describe(c) {
+			described[m.Name] = true
+		}
+	}
+	for _, r := range alertRules {
+		for _, name := range r.metrics {
+			if !described[name] {
+				return fmt.Errorf("rule %s: no collector describes %s", r.Alert, name)
+			}
+		}
+	}
+	return rulesTemplate.Execute(w, alertRules)
+}
+
+// Grafana のダッシュボード JSON のうち使う部分だけ
+type dashboard struct {
+	Title         string            `json:"title"`
+	UID           string            `json:"uid"`
+	SchemaVersion int               `json:"schemaVersion"`
+	Time          map[string]string `json:"time"`
+	Templating    struct {
+		List []dashboardVariable `json:"list"`
+	} `json:"templating"`
+	Panels []dashboardPanel `json:"panels"`
+}
+
+type dashboardVariable struct {
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Label      string      `json:"label,omitempty"`
+	Query      interface{} `json:"query"`
+	Datasource interface{} `json:"datasource,omitempty"`
+	Refresh    int         `json:"refresh,omitempty"`
+	IncludeAll bool        `json:"includeAll,omitempty"`
+	Multi      bool        `json:"multi,omitempty"`
+}
+
+type dashboardPanel struct {
+	ID          int               `json:"id"`
+	Type        string            `json:"type"`
+	Title       string            `json:"title"`
+	Description string            `json:"description,omitempty"`
+	Datasource  string            `json:"datasource,omitempty"`
+	GridPos     map[string]int    `json:"gridPos"`
+	Targets     []dashboardTarget `json:"targets,omitempty"`
+	Collapsed   bool              `json:"collapsed,omitempty"`
+	Panels      []dashboardPanel  `json:"panels,omitempty"`
+}
+
+type dashboardTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	RefID        string `json:"refId"`
+}
+
+func writeDashboard(w io.Writer, collectors []namedCollector) error {
+	d := dashboard{
+		Title:         "Mirakurun",
+		UID:           "mirakurun-exporter",
+		SchemaVersion: 27,
+		Time:          map[string]string{"from": "now-6h", "to": "now"},
+	}
+	d.Templating.List = []dashboardVariable{
+		{Name: "datasource", Type: "datasource", Label: "Data source", Query: "prometheus"},
+		{
+			Name:       "host",
+			Type:       "query",
+			Label:      "Host",
+			Query:      "label_values(mirakurun_up, host)",
+			Datasource: "$datasource",
+			Refresh:    2,
+			IncludeAll: true,
+			Multi:      true,
+		},
+	}
+
+	// コレクターごとに折りたたんだ行にまとめる
+	id, y := 0, 0
+	for _, c := range collectors {
+		metrics := collector.Describe(c)
+		if len(metrics) == 0 {
+			continue
+		}
+		id++
+		row := dashboardPanel{
+			ID:        id,
+			Type:      "row",
+			Title:     c.name,
+			Collapsed: true,
+			GridPos:   map[string]int{"h": 1, "w": 24, "x": 0, "y": y},
+		}
+		y++
+		for i, m := range metrics {
+			id++
+			row.Panels = append(row.Panels, dashboardPanel{
+				ID:          id,
+				Type:        "timeseries",
+				Title:       m.Name,
+				Description: m.Help,
+				Datasource:  "$datasource",
+				GridPos:     map[string]int{"h": 8, "w": 12, "x": i % 2 * 12, "y": y + i/2*8},
+				Targets:     []dashboardTarget{panelTarget(m)},
+			})
+		}
+		d.Panels = append(d.Panels, row)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// snapshotHistograms are the histograms rebuilt from the EPG on every
+// scrape. Their buckets are not cumulative over time, so they are not rated.
+var snapshotHistograms = map[string]bool{
+	"mirakurun_programs_duration_seconds": true,
+	"mirakurun_programs_advance_seconds":  true,
+}
+
+func panelTarget(m collector.MetricInfo) dashboardTarget {
+	selector := `{host=~"$host"}`
+	var legend []string
+	for _, l := range m.Labels {
+		if l != "host" {
+			legend = append(legend, "{{"+l+"}}")
+		}
+	}
+
+	t := dashboardTarget{RefID: "A"}
+	switch m.Type {
+	case collector.MetricCounter:
+		t.Expr = fmt.Sprintf("rate(%s%s[$__rate_interval])", m.Name, selector)
+	case collector.MetricHistogram:
+		by := strings.Join(append([]string{"le"}, m.Labels...), ", ")
+		buckets := fmt.Sprintf("%s_bucket%s", m.Name, selector)
+		if !snapshotHistograms[m.Name] {
+			buckets = fmt.Sprintf("rate(%s[$__rate_interval])", buckets)
+		}
+		t.Expr = fmt.Sprintf("histogram_quantile(0.5, sum by (%s) (%s))", by, buckets)
+	default:
+		t.Expr = m.Name + selector
+	}
+	t.LegendFormat = "{{host}}"
+	if len(legend) > 0 {
+		t.LegendFormat += " " + strings.Join(legend, " ")
+	}
+	return t
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"mirakurun-exporter/collector"
+)
+
+// healthyHandler answers as long as the exporter is running.
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "Healthy")
+}
+
+// readyHandler answers 200 when Mirakurun answered a request within window.
+// If no scrape has done it recently, it pings /api/version instead of
+// collecting /api/status.
+func readyHandler(window time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if time.Since(collector.LastPoll()) > window {
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			err := collector.Ping(ctx)
+			cancel()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Not ready: %v", err), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintln(w, "Ready")
+	})
+}
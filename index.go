@@ -0,0 +1,204 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"mirakurun-exporter/collector"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeResult is the outcome of the last Collect of a collector.
+type scrapeResult struct {
+	Time     time.Time
+	Duration time.Duration
+	Samples  int
+	Err      string
+}
+
+// scrapeTracker keeps the last scrape result of each collector for the
+// index page.
+type scrapeTracker struct {
+	mu      sync.Mutex
+	results map[string]scrapeResult
+}
+
+func newScrapeTracker(collectors []namedCollector) *scrapeTracker {
+	return &scrapeTracker{results: make(map[string]scrapeResult, len(collectors))}
+}
+
+func (t *scrapeTracker) wrap(c namedCollector) prometheus.Collector {
+	return &trackedCollector{namedCollector: c, tracker: t}
+}
+
+func (t *scrapeTracker) result(name string) (scrapeResult, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.results[name]
+	return r, ok
+}
+
+type trackedCollector struct {
+	namedCollector
+	tracker *scrapeTracker
+}
+
+func (c *trackedCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	samples := 0
+	inner := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range inner {
+			samples++
+			ch <- m
+		}
+		close(done)
+	}()
+	c.Collector.Collect(inner)
+	close(inner)
+	<-done
+
+	// Collect の間に記録されたエラーを失敗とみなす
+	r := scrapeResult{Time: start, Duration: time.Since(start), Samples: samples}
+	if e, ok := collector.LastError(c.name); ok && !e.Time.Before(start) {
+		r.Err = e.Message
+	}
+
+	c.tracker.mu.Lock()
+	c.tracker.results[c.name] = r
+	c.tracker.mu.Unlock()
+}
+
+type buildInfo struct {
+	Version   string
+	Revision  string
+	GoVersion string
+}
+
+func readBuildInfo() buildInfo {
+	b := buildInfo{Version: "(devel)", GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	if info.Main.Version != "" {
+		b.Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			b.Revision = s.Value
+		}
+	}
+	return b
+}
+
+type collectorStatus struct {
+	Name      string
+	Enabled   bool
+	Scraped   bool
+	Scrape    scrapeResult
+	LastError *collector.CollectorError
+	// Run で動いている処理のエラー。スクレイプの結果には含めない
+	LastBackgroundError *collector.CollectorError
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<title>Mirakurun Exporter</title>
+	<style>
+		table { border-collapse: collapse; }
+		th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+		.ok { color: green; }
+		.error { color: red; }
+		.disabled { color: gray; }
+	</style>
+</head>
+<body>
+	<h1>Mirakurun Exporter</h1>
+	<p><a href="/metrics">Metrics</a> | <a href="/metrics/catalog">Metrics catalog</a></p>
+
+	<h2>Targets</h2>
+	<table>
+		{{- range .Targets }}
+		<tr><th>{{ .Name }}</th><td>{{ .URL }}</td></tr>
+		{{- end }}
+	</table>
+
+	<h2>Collectors</h2>
+	<table>
+		<tr><th>Collector</th><th>Last scrape</th><th>Result</th><th>Duration</th><th>Samples</th><th>Last error</th><th>Last background error</th></tr>
+		{{- range .Collectors }}
+		<tr>
+			<td>{{ .Name }}</td>
+			{{- if not .Enabled }}
+			<td colspan="4" class="disabled">disabled</td>
+			{{- else if not .Scraped }}
+			<td colspan="4">not scraped yet</td>
+			{{- else }}
+			<td>{{ .Scrape.Time.Format "2006-01-02 15:04:05" }}</td>
+			{{- if .Scrape.Err }}
+			<td class="error">error</td>
+			{{- else }}
+			<td class="ok">ok</td>
+			{{- end }}
+			<td>{{ .Scrape.Duration }}</td>
+			<td>{{ .Scrape.Samples }}</td>
+			{{- end }}
+			<td>{{ with .LastError }}{{ .Time.Format "2006-01-02 15:04:05" }} {{ .Message }}{{ end }}</td>
+			<td>{{ with .LastBackgroundError }}{{ .Time.Format "2006-01-02 15:04:05" }} {{ .Message }}{{ end }}</td>
+		</tr>
+		{{- end }}
+	</table>
+
+	<h2>Build</h2>
+	<table>
+		<tr><th>Version</th><td>{{ .Build.Version }}</td></tr>
+		{{- if .Build.Revision }}
+		<tr><th>Revision</th><td>{{ .Build.Revision }}</td></tr>
+		{{- end }}
+		<tr><th>Go</th><td>{{ .Build.GoVersion }}</td></tr>
+	</table>
+</body>
+</html>
+`))
+
+// indexHandler serves the status page of the exporter.
+func indexHandler(collectors []namedCollector, scrapes *scrapeTracker) http.Handler {
+	build := readBuildInfo()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var statuses []collectorStatus
+		for _, c := range collectors {
+			s := collectorStatus{Name: c.name, Enabled: true}
+			if e, ok := c.Collector.(interface{ Enabled() bool }); ok {
+				s.Enabled = e.Enabled()
+			}
+			s.Scrape, s.Scraped = scrapes.result(c.name)
+			if e, ok := collector.LastError(c.name); ok {
+				s.LastError = &e
+			}
+			if e, ok := collector.LastBackgroundError(c.name); ok {
+				s.LastBackgroundError = &e
+			}
+			statuses = append(statuses, s)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		indexTemplate.Execute(w, struct {
+			Targets    []collector.Target
+			Collectors []collectorStatus
+			Build      buildInfo
+		}{collector.Targets(), statuses, build})
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"mirakurun-exporter/collector"
+)
+
+// lint runs the lint subcommand and returns the exit code: 0 when no
+// problem is found, 1 when there are problems and 2 when Mirakurun could not
+// be checked.
+func lint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := fs.String("format", "text", "Output format, text or json.")
+	fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		slog.Error("unknown format", "format", *format)
+		return 2
+	}
+
+	problems, err := collector.Lint(context.Background())
+	if err != nil {
+		slog.Error("lint failed", "err", err)
+		return 2
+	}
+
+	switch *format {
+	case "json":
+		if problems == nil {
+			problems = []collector.LintProblem{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			Problems []collector.LintProblem `json:"problems"`
+		}{problems})
+	default:
+		for _, p := range problems {
+			fmt.Printf("%s: %s\n", p.Check, p.Message)
+		}
+		fmt.Printf("%d problem(s) found\n", len(problems))
+	}
+
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// newLogger returns the logger configured by LOG_LEVEL (debug, info, warn
+// or error) and LOG_FORMAT (logfmt or json).
+func newLogger() *slog.Logger {
+	var level slog.Level
+	if v, ok := os.LookupEnv("LOG_LEVEL"); ok {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			fmt.Fprintf(os.Stderr, "LOG_LEVEL: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "logfmt":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts))
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	default:
+		fmt.Fprintf(os.Stderr, "LOG_FORMAT: unknown format %q\n", format)
+		os.Exit(1)
+		return nil
+	}
+}
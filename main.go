@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"mirakurun-exporter/collector"
 
@@ -12,38 +18,121 @@ import (
 )
 
 var (
-	addr = flag.String("listen address", ":9100", "The Address to listen on for HTTP Requests.")
+	addr            = flag.String("listen address", ":9100", "The Address to listen on for HTTP Requests.")
+	enableLifecycle = flag.Bool("web.enable-lifecycle", false, "Enable reload via HTTP request.")
 )
 
 func main() {
 	flag.Parse()
+	slog.SetDefault(newLogger())
+	if err := collector.LoadConfig(); err != nil {
+		slog.Error("failed to load target config", "err", err)
+		os.Exit(1)
+	}
+
+	switch flag.Arg(0) {
+	case "":
+	case "generate":
+		os.Exit(generate(flag.Args()[1:]))
+	case "lint":
+		os.Exit(lint(flag.Args()[1:]))
+	default:
+		slog.Error("unknown command", "command", flag.Arg(0))
+		os.Exit(1)
+	}
 
-	s := collector.NewStatusCollector()
-	v := collector.NewVersionCollector()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
+	collectors := newCollectors()
+	scrapes := newScrapeTracker(collectors)
 	reg := prometheus.NewRegistry()
-	reg.MustRegister(s, v)
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	var runners sync.WaitGroup
+	for _, c := range collectors {
+		reg.MustRegister(scrapes.wrap(c))
+		if r, ok := c.Collector.(runner); ok {
+			runners.Add(1)
+			go func() {
+				defer runners.Done()
+				r.Run(ctx)
+			}()
+		}
+	}
+	go reloadOnSignal(ctx)
+
+	runners.Add(1)
+	go func() {
+		defer runners.Done()
+		pushLoop(ctx, lookupPushConfig(), reg)
+	}()
+
+	http.Handle("/", indexHandler(collectors, scrapes))
+	http.Handle("/metrics", promhttp.InstrumentMetricHandler(reg, promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+	http.Handle("/metrics/catalog", catalogHandler(collectors))
+	http.HandleFunc("/-/healthy", healthyHandler)
+	http.Handle("/-/ready", readyHandler(collector.LookupEnvDuration("MIRAKURUN_READY_WINDOW", 5*time.Minute)))
+	if *enableLifecycle {
+		http.HandleFunc("/-/reload", reloadHandler)
+	}
 
-	http.HandleFunc("/", indexPage)
-	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: *addr}
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "address", *addr)
+		errc <- srv.ListenAndServe()
+	}()
 
-	log.Println("Listening on ", *addr)
-	if err := http.ListenAndServe(*addr, nil); err != nil {
-		log.Fatal(err)
+	select {
+	case err := <-errc:
+		slog.Error("failed to serve", "err", err)
+		os.Exit(1)
+	case <-ctx.Done():
 	}
+
+	// 処理中のスクレイプを待ってから止める
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("failed to shut down gracefully", "err", err)
+	}
+	runners.Wait()
+}
+
+// namedCollector is a collector with the name it logs its errors with.
+type namedCollector struct {
+	name string
+	prometheus.Collector
 }
 
-func indexPage(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<title>Mirakurun Exporter</title>
-		</head>
-		<body>
-			<h1>Mirakurn Exporter</h1>
-			<p><a href="/metrics">Metrics</a></p>
-		</body>
-		</html>
-	`))
+// runner is implemented by the collectors that do their work in the
+// background.
+type runner interface {
+	Run(ctx context.Context)
+}
+
+// newCollectors returns every collector of the exporter. Constructing them
+// does not contact Mirakurun.
+func newCollectors() []namedCollector {
+	return []namedCollector{
+		{"status", collector.NewStatusCollector()},
+		{"version", collector.NewVersionCollector()},
+		{"tuner", collector.NewTunerCollector()},
+		{"probe", collector.NewProbeCollector()},
+		{"signal", collector.NewSignalCollector()},
+		{"config/server", collector.NewServerConfigCollector()},
+		{"config", collector.NewConfigDriftCollector()},
+		{"forecast", collector.NewForecastCollector()},
+		{"epgstation", collector.NewEPGStationCollector()},
+		{"chinachu", collector.NewChinachuCollector()},
+		{"timeshift", collector.NewTimeshiftCollector()},
+		{"onair", collector.NewOnAirCollector()},
+		{"genre", collector.NewGenreCollector()},
+		{"epg watch", collector.NewEPGWatchCollector()},
+		{"upstream", collector.NewUpstreamCollector()},
+	}
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"mirakurun-exporter/collector"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// pushConfig is read from MIRAKURUN_PUSH_*. Push mode is enabled when
+// either a Pushgateway or a remote-write URL is set.
+type pushConfig struct {
+	gateway      string
+	remoteWrite  string
+	job          string
+	instance     string
+	interval     time.Duration
+	bufferDir    string
+	bufferMaxAge time.Duration
+}
+
+func lookupPushConfig() pushConfig {
+	c := pushConfig{
+		gateway:      os.Getenv("MIRAKURUN_PUSH_GATEWAY"),
+		remoteWrite:  os.Getenv("MIRAKURUN_PUSH_REMOTE_WRITE"),
+		job:          "mirakurun",
+		interval:     collector.LookupEnvDuration("MIRAKURUN_PUSH_INTERVAL", time.Minute),
+		bufferDir:    os.Getenv("MIRAKURUN_PUSH_BUFFER"),
+		bufferMaxAge: collector.LookupEnvDuration("MIRAKURUN_PUSH_BUFFER_MAX_AGE", time.Hour),
+	}
+	if v, ok := os.LookupEnv("MIRAKURUN_PUSH_JOB"); ok {
+		c.job = v
+	}
+	c.instance, _ = os.Hostname()
+	if v, ok := os.LookupEnv("MIRAKURUN_PUSH_INSTANCE"); ok {
+		c.instance = v
+	}
+	return c
+}
+
+func (c pushConfig) enabled() bool {
+	return c.gateway != "" || c.remoteWrite != ""
+}
+
+// pushLoop gathers g every interval and pushes it until ctx is done.
+func pushLoop(ctx context.Context, c pushConfig, g prometheus.Gatherer) {
+	if !c.enabled() {
+		return
+	}
+
+	var rw *remoteWriter
+	if c.remoteWrite != "" {
+		rw = newRemoteWriter(c)
+	}
+	var pusher *push.Pusher
+	if c.gateway != "" {
+		pusher = push.New(c.gateway, c.job).Gatherer(g).Grouping("instance", c.instance)
+	}
+
+	for {
+		if pusher != nil {
+			err := retry(ctx, func() error { return pusher.Push() })
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("push to pushgateway failed", "url", c.gateway, "err", err)
+			}
+		}
+		if rw != nil {
+			rw.write(ctx, g)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+// permanentError is an error retrying does not help with, such as a 400.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+func isPermanent(err error) bool {
+	return errors.As(err, &permanentError{})
+}
+
+// retry calls f up to 3 times, backing off between the attempts.
+func retry(ctx context.Context, f func() error) error {
+	backoff := time.Second
+	var err error
+	for i := 0; ; i++ {
+		if err = f(); err == nil || isPermanent(err) || i == 2 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
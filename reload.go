@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"mirakurun-exporter/collector"
+)
+
+// reload re-reads the target configuration file. The current configuration
+// is kept if it fails.
+func reload() error {
+	if err := collector.LoadConfig(); err != nil {
+		slog.Error("failed to reload target config", "err", err)
+		return err
+	}
+	slog.Info("reloaded target config")
+	return nil
+}
+
+func reloadOnSignal(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reload()
+		}
+	}
+}
+
+// reloadHandler reloads on POST or PUT like Prometheus.
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "Only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := reload(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reload: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "Reloaded")
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type label struct {
+	name, value string
+}
+
+type timeSeries struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+// remoteWriter sends the gathered metrics with the Prometheus remote-write
+// protocol. Requests that fail are kept in bufferDir and sent again, oldest
+// first, before the next ones.
+type remoteWriter struct {
+	url          string
+	job          string
+	instance     string
+	bufferDir    string
+	bufferMaxAge time.Duration
+	client       *http.Client
+}
+
+func newRemoteWriter(c pushConfig) *remoteWriter {
+	if c.bufferDir != "" {
+		if err := os.MkdirAll(c.bufferDir, 0o755); err != nil {
+			slog.Error("failed to create push buffer", "path", c.bufferDir, "err", err)
+			os.Exit(1)
+		}
+	}
+	return &remoteWriter{
+		url:          c.remoteWrite,
+		job:          c.job,
+		instance:     c.instance,
+		bufferDir:    c.bufferDir,
+		bufferMaxAge: c.bufferMaxAge,
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (w *remoteWriter) write(ctx context.Context, g prometheus.Gatherer) {
+	now := time.Now()
+	families, err := g.Gather()
+	if err != nil {
+		// 一部のコレクターが失敗しても集められた分は送る
+		slog.Warn("gather for remote write failed", "err", err)
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(w.timeSeries(families, now)))
+
+	if !w.flush(ctx) {
+		w.buffer(body, now)
+		return
+	}
+	if err := retry(ctx, func() error { return w.send(ctx, body) }); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("remote write failed", "url", w.url, "err", err)
+		if !isPermanent(err) {
+			w.buffer(body, now)
+		}
+	}
+}
+
+func (w *remoteWriter) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "mirakurun-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("%s: %s", w.url, res.Status)
+	// 429 と 5xx 以外は送り直しても受け付けられない
+	if res.StatusCode != http.StatusTooManyRequests && res.StatusCode/100 != 5 {
+		return permanentError{err}
+	}
+	return err
+}
+
+// buffer keeps body to send it later. It does nothing without bufferDir.
+func (w *remoteWriter) buffer(body []byte, at time.Time) {
+	if w.bufferDir == "" {
+		return
+	}
+	path := filepath.Join(w.bufferDir, strconv.FormatInt(at.UnixNano(), 10)+".snappy")
+	if err := ioutil.WriteFile(path, body, 0o644); err != nil {
+		slog.Warn("failed to buffer remote write", "path", path, "err", err)
+	}
+}
+
+// flush sends the buffered requests oldest first, and reports whether the
+// buffer is now empty. Requests older than bufferMaxAge are dropped since
+// Prometheus would reject their samples anyway.
+func (w *remoteWriter) flush(ctx context.Context) bool {
+	if w.bufferDir == "" {
+		return true
+	}
+	names, err := filepath.Glob(filepath.Join(w.bufferDir, "*.snappy"))
+	if err != nil {
+		return true
+	}
+	// ファイル名はナノ秒なので桁数が同じ間は文字列順で古い順になる
+	sort.Strings(names)
+
+	for _, name := range names {
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), ".snappy"), 10, 64)
+		if err != nil || time.Since(time.Unix(0, nanos)) > w.bufferMaxAge {
+			os.Remove(name)
+			continue
+		}
+		body, err := ioutil.ReadFile(name)
+		if err != nil {
+			os.Remove(name)
+			continue
+		}
+		if err := w.send(ctx, body); err != nil && !isPermanent(err) {
+			return false
+		}
+		os.Remove(name)
+	}
+	return true
+}
+
+// timeSeries flattens the metric families into the samples of the remote
+// write protocol, adding job and instance like a scrape would.
+func (w *remoteWriter) timeSeries(families []*dto.MetricFamily, now time.Time) []timeSeries {
+	ts := now.UnixNano() / int64(time.Millisecond)
+	var series []timeSeries
+	add := func(name string, m *dto.Metric, v float64, extra ...label) {
+		labels := []label{{"__name__", name}, {"job", w.job}, {"instance", w.instance}}
+		for _, l := range m.GetLabel() {
+			labels = append(labels, label{l.GetName(), l.GetValue()})
+		}
+		labels = append(labels, extra...)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+		t := ts
+		if m.TimestampMs != nil {
+			t = m.GetTimestampMs()
+		}
+		series = append(series, timeSeries{labels: labels, value: v, timestamp: t})
+	}
+
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m, m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add(name+"_bucket", m, float64(b.GetCumulativeCount()), label{"le", formatFloat(b.GetUpperBound())})
+				}
+				add(name+"_bucket", m, float64(h.GetSampleCount()), label{"le", "+Inf"})
+				add(name+"_sum", m, h.GetSampleSum())
+				add(name+"_count", m, float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, m, q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", m, s.GetSampleSum())
+				add(name+"_count", m, float64(s.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes prometheus.WriteRequest by hand, which is
+// small enough not to pull in the Prometheus server for its generated code.
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []timeSeries) []byte {
+	var b []byte
+	for _, s := range series {
+		var t []byte
+		for _, l := range s.labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.value)
+			t = protowire.AppendTag(t, 1, protowire.BytesType)
+			t = protowire.AppendBytes(t, lb)
+		}
+
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.timestamp))
+		t = protowire.AppendTag(t, 2, protowire.BytesType)
+		t = protowire.AppendBytes(t, sb)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, t)
+	}
+	return b
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest decodes what encodeWriteRequest writes field by field,
+// so that a wrong field number or wire type is caught.
+func decodeWriteRequest(t *testing.T, b []byte) []timeSeries {
+	t.Helper()
+	var series []timeSeries
+	consumeFields(t, b, func(num protowire.Number, typ protowire.Type, v []byte) {
+		if num != 1 || typ != protowire.BytesType {
+			t.Fatalf("write request field %d has wire type %d", num, typ)
+		}
+		var s timeSeries
+		consumeFields(t, v, func(num protowire.Number, typ protowire.Type, v []byte) {
+			switch {
+			case num == 1 && typ == protowire.BytesType:
+				var l label
+				consumeFields(t, v, func(num protowire.Number, typ protowire.Type, v []byte) {
+					switch {
+					case num == 1 && typ == protowire.BytesType:
+						l.name = string(v)
+					case num == 2 && typ == protowire.BytesType:
+						l.value = string(v)
+					default:
+						t.Fatalf("label field %d has wire type %d", num, typ)
+					}
+				})
+				s.labels = append(s.labels, l)
+			case num == 2 && typ == protowire.BytesType:
+				consumeFields(t, v, func(num protowire.Number, typ protowire.Type, v []byte) {
+					switch {
+					case num == 1 && typ == protowire.Fixed64Type:
+						f, _ := protowire.ConsumeFixed64(v)
+						s.value = math.Float64frombits(f)
+					case num == 2 && typ == protowire.VarintType:
+						n, _ := protowire.ConsumeVarint(v)
+						s.timestamp = int64(n)
+					default:
+						t.Fatalf("sample field %d has wire type %d", num, typ)
+					}
+				})
+			default:
+				t.Fatalf("time series field %d has wire type %d", num, typ)
+			}
+		})
+		series = append(series, s)
+	})
+	return series
+}
+
+// consumeFields calls f with every field of the message in b. v is the
+// content of a length-delimited field and the raw value of the others.
+func consumeFields(t *testing.T, b []byte, f func(num protowire.Number, typ protowire.Type, v []byte)) {
+	t.Helper()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		v := b
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(b)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n >= 0 {
+				v = b[:n]
+			}
+		}
+		if n < 0 {
+			t.Fatalf("bad field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		f(num, typ, v)
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "test_gauge",
+		Help: "Gauge.",
+	}, []string{"zone", "app"})
+	gauge.WithLabelValues("b", "a").Set(1.5)
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "test_seconds",
+		Help:    "Histogram.",
+		Buckets: []float64{0.5, 1},
+	})
+	hist.Observe(0.25)
+	hist.Observe(0.75)
+	hist.Observe(3)
+	reg.MustRegister(gauge, hist)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &remoteWriter{job: "mirakurun", instance: "recorder"}
+	now := time.Unix(1700000000, 123000000)
+	got := decodeWriteRequest(t, encodeWriteRequest(w.timeSeries(families, now)))
+
+	const ts = 1700000000123
+	common := func(name string, extra ...label) []label {
+		labels := []label{{"__name__", name}, {"instance", "recorder"}, {"job", "mirakurun"}}
+		return append(labels, extra...)
+	}
+	want := []timeSeries{
+		{labels: []label{{"__name__", "test_gauge"}, {"app", "a"}, {"instance", "recorder"}, {"job", "mirakurun"}, {"zone", "b"}}, value: 1.5, timestamp: ts},
+		{labels: common("test_seconds_bucket", label{"le", "0.5"}), value: 1, timestamp: ts},
+		{labels: common("test_seconds_bucket", label{"le", "1"}), value: 2, timestamp: ts},
+		{labels: common("test_seconds_bucket", label{"le", "+Inf"}), value: 3, timestamp: ts},
+		{labels: common("test_seconds_sum"), value: 4, timestamp: ts},
+		{labels: common("test_seconds_count"), value: 3, timestamp: ts},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+	for _, s := range got {
+		for i := 1; i < len(s.labels); i++ {
+			if s.labels[i-1].name >= s.labels[i].name {
+				t.Errorf("labels of %v are not sorted", s.labels)
+			}
+		}
+	}
+}